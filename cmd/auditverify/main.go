@@ -0,0 +1,35 @@
+// Command auditverify checks the audit log's hash chain and exits non-zero if
+// any entry was altered, inserted or removed.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/arzan03/SecureShare/internal/audit"
+	"github.com/arzan03/SecureShare/internal/config"
+	"github.com/arzan03/SecureShare/internal/db"
+)
+
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	db.ConnectMongoDB(cfg.Mongo.URI, cfg.Mongo.Database)
+
+	report, err := audit.Verify(context.Background())
+	if err != nil {
+		log.Fatalf("Audit verification failed: %v", err)
+	}
+
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+
+	if !report.Valid {
+		os.Exit(1)
+	}
+}
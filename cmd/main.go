@@ -1,54 +1,98 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"log"
+	"net"
 	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/arzan03/SecureShare/internal/config"
 	"github.com/arzan03/SecureShare/internal/db"
+	"github.com/arzan03/SecureShare/internal/events"
 	"github.com/arzan03/SecureShare/internal/handlers"
+	"github.com/arzan03/SecureShare/internal/mailer"
 	"github.com/arzan03/SecureShare/internal/middleware"
+	"github.com/arzan03/SecureShare/internal/services"
 	"github.com/arzan03/SecureShare/internal/storage"
+	"github.com/arzan03/SecureShare/internal/utils"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
-	"github.com/joho/godotenv"
 )
 
 func main() {
-	// Load .env file if it exists
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found or error loading it, using environment variables")
+	// Load the config file, .env and environment; refuse to start on invalid settings
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
 	}
+	services.Configure(cfg)
+	middleware.Configure(cfg.Auth)
+	middleware.ConfigureProxies(cfg.Server)
+	mailer.Configure(cfg.Mail)
 
-	// Initialize Fiber
-	app := fiber.New()
+	// Initialize Fiber. Client IPs come from X-Forwarded-For only when the
+	// request arrives through one of the trusted proxies.
+	app := fiber.New(serverConfig(cfg.Server))
 	// Initialize MinIO
-	storage.InitMinio()
+	storage.InitMinio(cfg.Storage)
 	// Middleware
 	app.Use(logger.New())
 	app.Use(cors.New())
 
-	// Get MongoDB URI from environment
-	mongoURI := os.Getenv("MONGO_URI")
-	if mongoURI == "" {
-		mongoURI = "mongodb://localhost:27017/secure_files" // Default fallback
+	// Connect to MongoDB
+	mongoDB := db.ConnectMongoDB(cfg.Mongo.URI, cfg.Mongo.Database)
+	if err := db.EnsureIndexes(mongoDB); err != nil {
+		log.Printf("Warning: %v", err)
 	}
 
-	// Connect to MongoDB
-	mongoDB := db.ConnectMongoDB(mongoURI, "secure_files")
+	// Background workers run until shutdown has drained the HTTP server, as does
+	// work requests start in the background
+	workers := newWorkerGroup()
+	services.SetBackgroundRunner(workers.Go)
+
+	// Attach side effects to the event bus and start its workers
+	services.RegisterEventSubscribers()
+	workers.Go(events.Start)
 
-	handlers.InitAdminHandler(mongoDB)
 	// Auth Routes
 	auth := app.Group("/auth")
 	auth.Post("/register", handlers.RegisterHandler)
 	auth.Post("/login", handlers.LoginHandler)
+	auth.Post("/reset-password", handlers.ResetPasswordHandler)
 
 	// Admin Routes
-	admin := app.Group("/admin", middleware.AdminMiddleware)
+	admin := app.Group("/admin", middleware.AdminMiddleware, middleware.AuditMiddleware)
 	admin.Get("/users", handlers.ListUsers)
 	admin.Get("/files", handlers.ListAllFiles)
+	admin.Get("/files/search", handlers.AdminSearchFilesHandler)
+	admin.Get("/stats", handlers.AdminStatsHandler)
+	admin.Get("/storage/reconcile", handlers.ReconcileStatusHandler)
+	admin.Post("/storage/reconcile", handlers.ReconcileStorageHandler)
 	admin.Get("/user/:userid", handlers.GetUserByID)
+	admin.Delete("/user/:userid", handlers.DeleteUserHandler)
+	admin.Post("/user/:userid/suspend", handlers.SuspendUserHandler)
+	admin.Post("/user/:userid/reactivate", handlers.ReactivateUserHandler)
+	admin.Put("/user/:userid/role", handlers.ChangeUserRoleHandler)
+	admin.Post("/user/:userid/password-reset", handlers.ForcePasswordResetHandler)
+	admin.Post("/user/:userid/impersonate", handlers.ImpersonateUserHandler)
+	admin.Get("/user/:userid/files", handlers.ListUserFiles)
 	admin.Delete("/file/:file_id", handlers.AdminDeleteFile)
+	admin.Post("/file/:file_id/link", handlers.AdminGenerateLinkHandler)
+	admin.Get("/file/:file_id/download", handlers.AdminDownloadFileHandler)
+	admin.Post("/files/bulk-delete", handlers.AdminBulkDeleteFiles)
+	admin.Put("/team/:id/quota", handlers.SetTeamQuotaHandler)
+	admin.Get("/webhooks", handlers.ListGlobalWebhooksHandler)
+	admin.Post("/webhooks", handlers.CreateGlobalWebhookHandler)
+	admin.Get("/audit", handlers.ListAuditLogHandler)
+	admin.Get("/audit/export", handlers.ExportAuditLogHandler)
+	admin.Get("/audit/verify", handlers.VerifyAuditLogHandler)
 
 	// File Routes
 	file := app.Group("/file", middleware.AuthMiddleware)
@@ -60,18 +104,225 @@ func main() {
 
 	file.Get("/download/:id", handlers.ValidateDownloadHandler)
 	file.Get("/list", handlers.ListUserFilesHandler)
+	file.Get("/search", handlers.SearchFilesHandler)
+	file.Get("/shared", handlers.SharedWithMeHandler)
 	file.Get("/metadata/:id", handlers.GetFileMetadataHandler)
+	file.Patch("/:id", handlers.UpdateFileMetadataHandler)
+	file.Post("/:id/rename", handlers.RenameFileHandler)
+	file.Post("/:id/copy", handlers.CopyFileHandler)
+	file.Post("/:id/transfer", handlers.TransferFileHandler)
+	file.Get("/:id/content", handlers.DirectDownloadHandler)
+	file.Get("/:id/rejections", handlers.ListLinkRejectionsHandler)
+	file.Get("/:id/access", handlers.FileAccessHandler)
+	file.Get("/:id/links/:link_id/access", handlers.LinkAccessHandler)
+	file.Post("/:id/link/reschedule", handlers.RescheduleLinkHandler)
+
+	// Upload request links for external contributors
+	file.Post("/requests", handlers.CreateUploadRequestHandler)
+	file.Get("/requests", handlers.ListUploadRequestsHandler)
+	file.Get("/requests/:id/files", handlers.ListUploadRequestFilesHandler)
+	file.Delete("/requests/:id", handlers.RevokeUploadRequestHandler)
+
+	// Access grants to other users
+	file.Get("/:id/shares", handlers.ListSharesHandler)
+	file.Post("/:id/shares", handlers.ShareFileHandler)
+	file.Delete("/:id/shares/:user_id", handlers.RevokeShareHandler)
+
+	// Trash endpoints - registered before "/:id" so "trash" is not taken as a file ID
+	file.Get("/trash", handlers.ListTrashHandler)
+	file.Post("/trash/:id/restore", handlers.RestoreFileHandler)
+	file.Delete("/trash/:id", handlers.PurgeFileHandler)
+	file.Delete("/trash", handlers.EmptyTrashHandler)
 
-	// Deletion endpoints - both use same handler now
+	// Deletion endpoints move files to the trash - both use same handler now
 	file.Delete("/:id", handlers.DeleteFileHandler)  // Single deletion with ID in URL
 	file.Post("/delete", handlers.DeleteFileHandler) // Handles both single and batch deletions from body
 
-	// Get port from environment
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080" // Default port
-	}
+	// Purge trashed files once they pass the retention period
+	workers.Go(func(ctx context.Context) {
+		services.StartTrashPurger(ctx, cfg.Maintenance.TrashRetention(), time.Hour)
+	})
+
+	// Warn owners about share links that are about to expire
+	workers.Go(func(ctx context.Context) {
+		services.StartLinkExpiryNotifier(ctx, cfg.Maintenance.LinkExpiryWarning(), 15*time.Minute)
+	})
+
+	// Retry failed webhook deliveries and report expired files
+	workers.Go(func(ctx context.Context) {
+		services.StartWebhookDispatcher(ctx, 15*time.Second)
+	})
+	workers.Go(func(ctx context.Context) {
+		services.StartFileExpiryWatcher(ctx, 5*time.Minute)
+	})
+
+	// Find objects and file records that lost their counterpart
+	workers.Go(func(ctx context.Context) {
+		services.StartStorageReconciler(ctx, cfg.Maintenance.ReconcileRepair, cfg.Maintenance.ReconcileInterval())
+	})
+
+	// Webhook Routes
+	webhooks := app.Group("/webhooks", middleware.AuthMiddleware)
+	webhooks.Post("/", handlers.CreateWebhookHandler)
+	webhooks.Get("/", handlers.ListWebhooksHandler)
+	webhooks.Delete("/:id", handlers.DeleteWebhookHandler)
+	webhooks.Get("/:id/deliveries", handlers.ListWebhookDeliveriesHandler)
+	webhooks.Post("/:id/deliveries/:delivery_id/redeliver", handlers.RedeliverWebhookHandler)
+
+	// Notification Routes
+	notifications := app.Group("/notifications", middleware.AuthMiddleware)
+	notifications.Get("/", handlers.ListNotificationsHandler)
+	notifications.Post("/read", handlers.MarkNotificationsReadHandler)
+	notifications.Get("/preferences", handlers.GetNotificationPreferencesHandler)
+	notifications.Put("/preferences", handlers.UpdateNotificationPreferencesHandler)
+
+	// Public upload request routes - the token in the URL is the credential
+	upload := app.Group("/upload")
+	upload.Get("/:token", handlers.GetUploadRequestHandler)
+	upload.Post("/:token", handlers.UploadViaRequestHandler)
+
+	// Team Routes
+	team := app.Group("/team", middleware.AuthMiddleware)
+	team.Post("/", handlers.CreateTeamHandler)
+	team.Get("/", handlers.ListTeamsHandler)
+	team.Get("/:id", middleware.TeamMiddleware(services.TeamRoleViewer), handlers.GetTeamHandler)
+	team.Patch("/:id", middleware.TeamMiddleware(services.TeamRoleAdmin), handlers.RenameTeamHandler)
+	team.Delete("/:id", middleware.TeamMiddleware(services.TeamRoleOwner), handlers.DeleteTeamHandler)
+	team.Get("/:id/files", middleware.TeamMiddleware(services.TeamRoleViewer), handlers.ListTeamFilesHandler)
+	team.Post("/:id/members", middleware.TeamMiddleware(services.TeamRoleAdmin), handlers.AddTeamMemberHandler)
+	team.Patch("/:id/members/:user_id", middleware.TeamMiddleware(services.TeamRoleAdmin), handlers.UpdateTeamMemberHandler)
+	team.Delete("/:id/members/:user_id", middleware.TeamMiddleware(services.TeamRoleViewer), handlers.RemoveTeamMemberHandler)
 
 	// Start server
-	log.Fatal(app.Listen(":" + port))
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- serve(app, cfg.Server)
+	}()
+
+	// On SIGINT or SIGTERM stop accepting connections and let in-flight
+	// requests, uploads and downloads included, finish before the deadline
+	signals, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	exitCode := 0
+	select {
+	case err := <-serveErr:
+		log.Printf("Server stopped: %v", err)
+		exitCode = 1
+	case <-signals.Done():
+		stopSignals() // From here a second signal terminates immediately
+		log.Printf("Shutting down, waiting up to %s for %d open connections",
+			cfg.Server.ShutdownTimeout, app.Server().GetOpenConnectionsCount())
+		if err := app.ShutdownWithTimeout(cfg.Server.ShutdownTimeout); err != nil {
+			log.Printf("Requests still running at the shutdown deadline were cut off: %v", err)
+		}
+	}
+
+	stopSignals()
+
+	// Then stop the background workers and close the database
+	if !workers.Stop(workerStopTimeout) {
+		log.Printf("Background workers did not stop within %s", workerStopTimeout)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := db.Disconnect(ctx); err != nil {
+		log.Printf("Failed to disconnect from MongoDB: %v", err)
+	}
+	cancel()
+	log.Println("Shutdown complete")
+	os.Exit(exitCode)
+}
+
+// workerStopTimeout bounds how long shutdown waits for background workers to return
+const workerStopTimeout = 15 * time.Second
+
+// workerGroup runs background workers that share a context cancelled on shutdown
+type workerGroup struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex // Orders Go against Stop
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+func newWorkerGroup() *workerGroup {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &workerGroup{ctx: ctx, cancel: cancel}
+}
+
+// Go starts a worker that must return once its context is cancelled. Once
+// Stop has been called, run is called on the caller's goroutine instead, so
+// late work is neither lost nor left running after shutdown.
+func (g *workerGroup) Go(run func(ctx context.Context)) {
+	g.mu.Lock()
+	if g.stopped {
+		g.mu.Unlock()
+		run(g.ctx)
+		return
+	}
+	g.wg.Add(1)
+	g.mu.Unlock()
+
+	go func() {
+		defer g.wg.Done()
+		run(g.ctx)
+	}()
+}
+
+// Stop cancels the workers and reports whether they all returned within timeout
+func (g *workerGroup) Stop(timeout time.Duration) bool {
+	g.mu.Lock()
+	g.stopped = true
+	g.mu.Unlock()
+
+	g.cancel()
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// serve listens on the configured port, over HTTPS when a certificate is configured
+func serve(app *fiber.App, cfg config.Server) error {
+	addr := ":" + strconv.Itoa(cfg.Port)
+	if cfg.TLSEnabled() {
+		return listenTLS(app, addr, cfg)
+	}
+	return app.Listen(addr)
+}
+
+// listenTLS serves HTTPS with a certificate that is reloaded when its files change
+func listenTLS(app *fiber.App, addr string, cfg config.Server) error {
+	certs, err := utils.NewCertReloader(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return app.Listener(tls.NewListener(ln, &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.GetCertificate,
+	}))
+}
+
+// serverConfig builds the Fiber configuration from the server settings
+func serverConfig(cfg config.Server) fiber.Config {
+	fiberConfig := fiber.Config{BodyLimit: cfg.BodyLimitMB * 1024 * 1024}
+
+	if len(cfg.TrustedProxies) > 0 {
+		fiberConfig.EnableTrustedProxyCheck = true
+		fiberConfig.TrustedProxies = cfg.TrustedProxies
+		// No ProxyHeader: Fiber would take the leftmost, client-supplied
+		// X-Forwarded-For entry, so client addresses come from middleware.ClientIP
+	}
+
+	return fiberConfig
 }
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestWorkerGroupStop checks Stop cancels the workers and waits for them
+func TestWorkerGroupStop(t *testing.T) {
+	workers := newWorkerGroup()
+	returned := make(chan struct{})
+	workers.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		time.Sleep(50 * time.Millisecond) // Finishing up after cancellation
+		close(returned)
+	})
+
+	if !workers.Stop(time.Second) {
+		t.Fatal("Expected Stop to report the workers returned")
+	}
+	select {
+	case <-returned:
+	default:
+		t.Error("Stop returned before the worker did")
+	}
+
+	// Work handed over after Stop runs on the caller's goroutine
+	ran := false
+	workers.Go(func(ctx context.Context) {
+		ran = ctx.Err() != nil
+	})
+	if !ran {
+		t.Error("Expected late work to run at once with a cancelled context")
+	}
+}
+
+// TestWorkerGroupStopTimeout checks Stop gives up on a worker that ignores cancellation
+func TestWorkerGroupStopTimeout(t *testing.T) {
+	workers := newWorkerGroup()
+	release := make(chan struct{})
+	defer close(release)
+	workers.Go(func(ctx context.Context) {
+		<-release
+	})
+
+	start := time.Now()
+	if workers.Stop(100 * time.Millisecond) {
+		t.Fatal("Expected Stop to report a worker still running")
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Expected Stop to wait for the timeout, took %s", elapsed)
+	}
+}
@@ -0,0 +1,232 @@
+// Package audit keeps an append-only, hash-chained trail of security relevant
+// actions. Every entry stores the hash of the one before it, so editing,
+// inserting or deleting an entry breaks the chain and is caught by Verify.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/arzan03/SecureShare/internal/db"
+	"github.com/arzan03/SecureShare/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	appendRetries = 5
+	maxProblems   = 100
+)
+
+// genesisHash is the previous hash of the first entry
+const genesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// appendMu serializes appends within this process; the unique index on seq
+// catches races with other instances
+var appendMu sync.Mutex
+
+func collection() *mongo.Collection {
+	return db.Collection("audit_log")
+}
+
+// hashInput lists the hashed fields in a fixed order
+type hashInput struct {
+	Seq          int64             `json:"seq"`
+	Time         string            `json:"time"`
+	Action       string            `json:"action"`
+	ActorID      string            `json:"actor_id"`
+	ActorEmail   string            `json:"actor_email"`
+	Impersonator string            `json:"impersonator,omitempty"` // Omitted when empty so older entries hash as before
+	TargetType   string            `json:"target_type"`
+	TargetID     string            `json:"target_id"`
+	IP           string            `json:"ip"`
+	Details      map[string]string `json:"details"` // Marshalled with sorted keys
+	PrevHash     string            `json:"prev_hash"`
+}
+
+// computeHash returns the hex SHA-256 of an entry's content and previous hash
+func computeHash(e models.AuditEntry) string {
+	if len(e.Details) == 0 {
+		e.Details = nil // Empty details are not stored, so hash them as absent
+	}
+	data, _ := json.Marshal(hashInput{
+		Seq:          e.Seq,
+		Time:         e.Time.UTC().Format(time.RFC3339Nano),
+		Action:       e.Action,
+		ActorID:      e.ActorID,
+		ActorEmail:   e.ActorEmail,
+		Impersonator: e.Impersonator,
+		TargetType:   e.TargetType,
+		TargetID:     e.TargetID,
+		IP:           e.IP,
+		Details:      e.Details,
+		PrevHash:     e.PrevHash,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Record appends an entry to the chain, filling in its sequence number, time and hashes
+func Record(ctx context.Context, e models.AuditEntry) error {
+	appendMu.Lock()
+	defer appendMu.Unlock()
+
+	// Mongo stores milliseconds, so hash exactly what will be read back
+	e.Time = time.Now().UTC().Truncate(time.Millisecond)
+
+	for attempt := 0; attempt < appendRetries; attempt++ {
+		var last models.AuditEntry
+		err := collection().FindOne(ctx, bson.M{}, options.FindOne().SetSort(bson.D{{Key: "seq", Value: -1}})).Decode(&last)
+		switch {
+		case errors.Is(err, mongo.ErrNoDocuments):
+			e.Seq, e.PrevHash = 1, genesisHash
+		case err != nil:
+			return fmt.Errorf("failed to read audit chain head: %w", err)
+		default:
+			e.Seq, e.PrevHash = last.Seq+1, last.Hash
+		}
+		e.Hash = computeHash(e)
+
+		_, err = collection().InsertOne(ctx, e)
+		if mongo.IsDuplicateKeyError(err) {
+			continue // Another instance appended first; chain onto its entry
+		}
+		if err != nil {
+			return fmt.Errorf("failed to append audit entry: %w", err)
+		}
+		return nil
+	}
+	return errors.New("failed to append audit entry: chain head kept moving")
+}
+
+// Filter selects audit entries
+type Filter struct {
+	Action       string
+	ActorID      string
+	Impersonator string
+	TargetID     string
+	Since        time.Time
+	Until        time.Time
+	AfterSeq     int64 // Resume after this sequence number
+}
+
+func (f Filter) query() bson.M {
+	query := bson.M{}
+	if f.Action != "" {
+		query["action"] = f.Action
+	}
+	if f.ActorID != "" {
+		query["actor_id"] = f.ActorID
+	}
+	if f.Impersonator != "" {
+		query["impersonator"] = f.Impersonator
+	}
+	if f.TargetID != "" {
+		query["target_id"] = f.TargetID
+	}
+	if !f.Since.IsZero() || !f.Until.IsZero() {
+		t := bson.M{}
+		if !f.Since.IsZero() {
+			t["$gte"] = f.Since
+		}
+		if !f.Until.IsZero() {
+			t["$lte"] = f.Until
+		}
+		query["time"] = t
+	}
+	if f.AfterSeq > 0 {
+		query["seq"] = bson.M{"$gt": f.AfterSeq}
+	}
+	return query
+}
+
+// Query returns up to limit matching entries in chain order
+func Query(ctx context.Context, f Filter, limit int) ([]models.AuditEntry, error) {
+	cursor, err := collection().Find(ctx, f.query(),
+		options.Find().SetSort(bson.D{{Key: "seq", Value: 1}}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	entries := []models.AuditEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, fmt.Errorf("error decoding audit entries: %w", err)
+	}
+	return entries, nil
+}
+
+// Each streams every matching entry in chain order to fn, stopping at its first error
+func Each(ctx context.Context, f Filter, fn func(models.AuditEntry) error) error {
+	cursor, err := collection().Find(ctx, f.query(), options.Find().SetSort(bson.D{{Key: "seq", Value: 1}}))
+	if err != nil {
+		return fmt.Errorf("failed to query audit log: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var e models.AuditEntry
+		if err := cursor.Decode(&e); err != nil {
+			return fmt.Errorf("error decoding audit entry: %w", err)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// Problem is one break in the chain found by Verify
+type Problem struct {
+	Seq    int64  `json:"seq"`
+	Reason string `json:"reason"`
+}
+
+// Report is the outcome of verifying the chain
+type Report struct {
+	Checked  int64     `json:"checked"`
+	Valid    bool      `json:"valid"`
+	Problems []Problem `json:"problems"`
+}
+
+// Verify walks the whole chain, recomputing every hash and checking that each
+// entry links to the one before it with no gaps in the sequence
+func Verify(ctx context.Context) (Report, error) {
+	report := Report{Problems: []Problem{}}
+	expectedSeq, prevHash := int64(1), genesisHash
+
+	err := Each(ctx, Filter{}, func(e models.AuditEntry) error {
+		report.Checked++
+		problem := func(reason string) {
+			if len(report.Problems) < maxProblems {
+				report.Problems = append(report.Problems, Problem{Seq: e.Seq, Reason: reason})
+			}
+		}
+
+		if e.Seq != expectedSeq {
+			problem(fmt.Sprintf("expected sequence %d; entries are missing or reordered", expectedSeq))
+		}
+		if e.PrevHash != prevHash {
+			problem("previous hash does not match the preceding entry")
+		}
+		if computeHash(e) != e.Hash {
+			problem("entry content does not match its hash")
+		}
+
+		expectedSeq, prevHash = e.Seq+1, e.Hash
+		return nil
+	})
+	if err != nil {
+		return Report{}, err
+	}
+
+	report.Valid = len(report.Problems) == 0
+	return report, nil
+}
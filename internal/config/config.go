@@ -0,0 +1,396 @@
+// Package config loads the server's settings from an optional YAML or TOML
+// file, a .env file and the environment, in increasing order of precedence.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"github.com/minio/minio-go/v7/pkg/s3utils"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is every setting of the server, validated by Load
+type Config struct {
+	Server      Server      `yaml:"server" toml:"server"`
+	Mongo       Mongo       `yaml:"mongo" toml:"mongo"`
+	Storage     Storage     `yaml:"storage" toml:"storage"`
+	Auth        Auth        `yaml:"auth" toml:"auth"`
+	Mail        Mail        `yaml:"mail" toml:"mail"`
+	Webhooks    Webhooks    `yaml:"webhooks" toml:"webhooks"`
+	Maintenance Maintenance `yaml:"maintenance" toml:"maintenance"`
+}
+
+// Server configures the HTTP listener
+type Server struct {
+	Port            int           `yaml:"port" toml:"port"`                         // PORT
+	TrustedProxies  []string      `yaml:"trusted_proxies" toml:"trusted_proxies"`   // TRUSTED_PROXIES, comma-separated IPs or CIDRs
+	BodyLimitMB     int           `yaml:"body_limit_mb" toml:"body_limit_mb"`       // BODY_LIMIT_MB, caps request and upload size
+	TLSCertFile     string        `yaml:"tls_cert_file" toml:"tls_cert_file"`       // TLS_CERT_FILE; serves HTTPS when set with the key
+	TLSKeyFile      string        `yaml:"tls_key_file" toml:"tls_key_file"`         // TLS_KEY_FILE
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"` // SHUTDOWN_TIMEOUT, how long in-flight requests may finish on shutdown
+}
+
+// TLSEnabled reports whether the server serves HTTPS
+func (s Server) TLSEnabled() bool {
+	return s.TLSCertFile != ""
+}
+
+// Mongo configures the database
+type Mongo struct {
+	URI      string `yaml:"uri" toml:"uri"`           // MONGO_URI
+	Database string `yaml:"database" toml:"database"` // MONGO_DATABASE
+}
+
+// Storage configures the MinIO object store
+type Storage struct {
+	Endpoint  string `yaml:"endpoint" toml:"endpoint"`     // MINIO_ENDPOINT, host:port or an http:// or https:// URL
+	AccessKey string `yaml:"access_key" toml:"access_key"` // MINIO_ACCESS_KEY
+	SecretKey string `yaml:"secret_key" toml:"secret_key"` // MINIO_SECRET_KEY
+	Bucket    string `yaml:"bucket" toml:"bucket"`         // MINIO_BUCKET
+	UseTLS    bool   `yaml:"use_tls" toml:"use_tls"`       // MINIO_USE_TLS, for endpoints given without a scheme
+	CAFile    string `yaml:"ca_file" toml:"ca_file"`       // MINIO_CA_FILE, PEM bundle trusted in addition to the system roots
+}
+
+// ParseEndpoint splits the endpoint into the host:port MinIO expects and
+// whether to use TLS. A scheme in the endpoint takes precedence over UseTLS.
+func (s Storage) ParseEndpoint() (string, bool, error) {
+	if !strings.Contains(s.Endpoint, "://") {
+		if s.Endpoint == "" || strings.ContainsAny(s.Endpoint, "/?#") {
+			return "", false, fmt.Errorf("storage endpoint %q must be host:port or a URL", s.Endpoint)
+		}
+		return s.Endpoint, s.UseTLS, nil
+	}
+
+	u, err := url.Parse(s.Endpoint)
+	if err != nil || u.Host == "" {
+		return "", false, fmt.Errorf("storage endpoint %q is not a valid URL", s.Endpoint)
+	}
+	if (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.User != nil {
+		return "", false, fmt.Errorf("storage endpoint %q must not have a path, query or credentials", s.Endpoint)
+	}
+	switch u.Scheme {
+	case "http":
+		return u.Host, false, nil
+	case "https":
+		return u.Host, true, nil
+	default:
+		return "", false, fmt.Errorf("storage endpoint %q must use http or https", s.Endpoint)
+	}
+}
+
+// Auth configures tokens
+type Auth struct {
+	JWTSecret        string        `yaml:"jwt_secret" toml:"jwt_secret"`                 // JWT_SECRET
+	TokenTTL         time.Duration `yaml:"token_ttl" toml:"token_ttl"`                   // TOKEN_TTL, e.g. "4h"
+	PasswordResetTTL time.Duration `yaml:"password_reset_ttl" toml:"password_reset_ttl"` // PASSWORD_RESET_TTL
+	ImpersonationTTL time.Duration `yaml:"impersonation_ttl" toml:"impersonation_ttl"`   // IMPERSONATION_TTL
+}
+
+// Mail configures outgoing email; with no host, messages are logged instead
+type Mail struct {
+	Host     string `yaml:"host" toml:"host"`         // SMTP_HOST
+	Port     int    `yaml:"port" toml:"port"`         // SMTP_PORT
+	Username string `yaml:"username" toml:"username"` // SMTP_USERNAME
+	Password string `yaml:"password" toml:"password"` // SMTP_PASSWORD
+	From     string `yaml:"from" toml:"from"`         // SMTP_FROM
+}
+
+// Webhooks configures outgoing webhook and notification deliveries
+type Webhooks struct {
+	AllowPrivate bool `yaml:"allow_private" toml:"allow_private"` // ALLOW_PRIVATE_WEBHOOKS, permits loopback and private network receivers
+}
+
+// Maintenance configures the background jobs
+type Maintenance struct {
+	TrashRetentionDays     int  `yaml:"trash_retention_days" toml:"trash_retention_days"`           // TRASH_RETENTION_DAYS
+	LinkExpiryWarningHours int  `yaml:"link_expiry_warning_hours" toml:"link_expiry_warning_hours"` // LINK_EXPIRY_WARNING_HOURS
+	ReconcileHours         int  `yaml:"reconcile_hours" toml:"reconcile_hours"`                     // STORAGE_RECONCILE_HOURS
+	ReconcileRepair        bool `yaml:"reconcile_repair" toml:"reconcile_repair"`                   // STORAGE_RECONCILE_REPAIR
+}
+
+// TrashRetention is how long trashed files are kept before they are purged
+func (m Maintenance) TrashRetention() time.Duration {
+	return time.Duration(m.TrashRetentionDays) * 24 * time.Hour
+}
+
+// LinkExpiryWarning is how long before a share link expires its owner is warned
+func (m Maintenance) LinkExpiryWarning() time.Duration {
+	return time.Duration(m.LinkExpiryWarningHours) * time.Hour
+}
+
+// ReconcileInterval is how often the background storage reconciliation runs
+func (m Maintenance) ReconcileInterval() time.Duration {
+	return time.Duration(m.ReconcileHours) * time.Hour
+}
+
+// Default returns the settings used for anything left unconfigured
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Port:            8080,
+			BodyLimitMB:     4, // Fiber's own default
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Mongo: Mongo{
+			URI:      "mongodb://localhost:27017/secure_files",
+			Database: "secure_files",
+		},
+		Storage: Storage{
+			Endpoint:  "localhost:9000",
+			AccessKey: "minioadmin",
+			SecretKey: "minioadmin",
+			Bucket:    "secure-files",
+		},
+		Auth: Auth{
+			// No JWT secret: one must be configured, so tokens are never signed with a known value
+			TokenTTL:         4 * time.Hour,
+			PasswordResetTTL: 24 * time.Hour,
+			ImpersonationTTL: 15 * time.Minute,
+		},
+		Mail: Mail{
+			Port: 587, // Default submission port
+			From: "no-reply@secureshare.local",
+		},
+		Maintenance: Maintenance{
+			TrashRetentionDays:     30,
+			LinkExpiryWarningHours: 24,
+			ReconcileHours:         24,
+		},
+	}
+}
+
+// Load builds the configuration: defaults, then the YAML or TOML file named by
+// CONFIG_FILE if set, then .env and the environment. Malformed or out of range
+// values are reported together rather than replaced by defaults.
+func Load() (*Config, error) {
+	// Variables already in the environment take precedence over .env
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read .env: %w", err)
+	}
+
+	cfg := Default()
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := loadFile(path, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	env := envReader{}
+	env.applyTo(cfg)
+	if len(env.errs) > 0 {
+		return nil, fmt.Errorf("invalid configuration: %w", errors.Join(env.errs...))
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadFile decodes a YAML or TOML file over cfg; unknown keys are errors so typos do not go unnoticed
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil {
+			return fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("invalid config file %s: unknown key %s", path, undecoded[0])
+		}
+	default:
+		return fmt.Errorf("config file %s must be .yaml, .yml or .toml", path)
+	}
+	return nil
+}
+
+// envReader overrides settings from environment variables, collecting parse errors
+type envReader struct {
+	errs []error
+}
+
+func (r *envReader) applyTo(cfg *Config) {
+	r.int("PORT", &cfg.Server.Port)
+	r.list("TRUSTED_PROXIES", &cfg.Server.TrustedProxies)
+	r.int("BODY_LIMIT_MB", &cfg.Server.BodyLimitMB)
+	r.string("TLS_CERT_FILE", &cfg.Server.TLSCertFile)
+	r.string("TLS_KEY_FILE", &cfg.Server.TLSKeyFile)
+	r.duration("SHUTDOWN_TIMEOUT", &cfg.Server.ShutdownTimeout)
+
+	r.string("MONGO_URI", &cfg.Mongo.URI)
+	r.string("MONGO_DATABASE", &cfg.Mongo.Database)
+
+	r.string("MINIO_ENDPOINT", &cfg.Storage.Endpoint)
+	r.string("MINIO_ACCESS_KEY", &cfg.Storage.AccessKey)
+	r.string("MINIO_SECRET_KEY", &cfg.Storage.SecretKey)
+	r.string("MINIO_BUCKET", &cfg.Storage.Bucket)
+	r.bool("MINIO_USE_TLS", &cfg.Storage.UseTLS)
+	r.string("MINIO_CA_FILE", &cfg.Storage.CAFile)
+
+	r.string("JWT_SECRET", &cfg.Auth.JWTSecret)
+	r.duration("TOKEN_TTL", &cfg.Auth.TokenTTL)
+	r.duration("PASSWORD_RESET_TTL", &cfg.Auth.PasswordResetTTL)
+	r.duration("IMPERSONATION_TTL", &cfg.Auth.ImpersonationTTL)
+
+	r.string("SMTP_HOST", &cfg.Mail.Host)
+	r.int("SMTP_PORT", &cfg.Mail.Port)
+	r.string("SMTP_USERNAME", &cfg.Mail.Username)
+	r.string("SMTP_PASSWORD", &cfg.Mail.Password)
+	r.string("SMTP_FROM", &cfg.Mail.From)
+
+	r.bool("ALLOW_PRIVATE_WEBHOOKS", &cfg.Webhooks.AllowPrivate)
+
+	r.int("TRASH_RETENTION_DAYS", &cfg.Maintenance.TrashRetentionDays)
+	r.int("LINK_EXPIRY_WARNING_HOURS", &cfg.Maintenance.LinkExpiryWarningHours)
+	r.int("STORAGE_RECONCILE_HOURS", &cfg.Maintenance.ReconcileHours)
+	r.bool("STORAGE_RECONCILE_REPAIR", &cfg.Maintenance.ReconcileRepair)
+}
+
+// lookup returns a variable's trimmed value; empty variables count as unset
+func lookup(key string) (string, bool) {
+	value := strings.TrimSpace(os.Getenv(key))
+	return value, value != ""
+}
+
+func (r *envReader) string(key string, dst *string) {
+	if value, ok := lookup(key); ok {
+		*dst = value
+	}
+}
+
+func (r *envReader) int(key string, dst *int) {
+	if value, ok := lookup(key); ok {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			r.errs = append(r.errs, fmt.Errorf("%s must be an integer", key))
+			return
+		}
+		*dst = n
+	}
+}
+
+func (r *envReader) bool(key string, dst *bool) {
+	if value, ok := lookup(key); ok {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			r.errs = append(r.errs, fmt.Errorf("%s must be true or false", key))
+			return
+		}
+		*dst = b
+	}
+}
+
+func (r *envReader) duration(key string, dst *time.Duration) {
+	if value, ok := lookup(key); ok {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			r.errs = append(r.errs, fmt.Errorf("%s must be a duration such as 30m or 4h", key))
+			return
+		}
+		*dst = d
+	}
+}
+
+func (r *envReader) list(key string, dst *[]string) {
+	if value, ok := lookup(key); ok {
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*dst = items
+	}
+}
+
+// placeholderSecrets are example JWT secrets shipped in earlier defaults and docs
+var placeholderSecrets = map[string]bool{
+	"supersecret":               true,
+	"changeme_in_production":    true,
+	"change_this_in_production": true,
+}
+
+// Validate reports every setting that is missing or out of range
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port <= 65535, "server port must be between 1 and 65535")
+	for _, proxy := range c.Server.TrustedProxies {
+		_, _, cidrErr := net.ParseCIDR(proxy)
+		check(net.ParseIP(proxy) != nil || cidrErr == nil, "trusted proxy %q is not an IP address or CIDR range", proxy)
+	}
+	check(c.Server.BodyLimitMB > 0, "body limit must be at least 1 MB")
+	check(c.Server.ShutdownTimeout > 0, "shutdown timeout must be positive")
+	check((c.Server.TLSCertFile == "") == (c.Server.TLSKeyFile == ""), "TLS certificate and key files must be set together")
+	if c.Server.TLSEnabled() {
+		check(fileExists(c.Server.TLSCertFile), "TLS certificate file %q cannot be read", c.Server.TLSCertFile)
+		check(fileExists(c.Server.TLSKeyFile), "TLS key file %q cannot be read", c.Server.TLSKeyFile)
+	}
+
+	check(c.Mongo.URI != "", "mongo URI is required")
+	check(c.Mongo.Database != "" && !strings.ContainsAny(c.Mongo.Database, `/\. "$`),
+		"mongo database %q is not a valid database name", c.Mongo.Database)
+
+	if _, _, err := c.Storage.ParseEndpoint(); err != nil {
+		errs = append(errs, err)
+	}
+	check(c.Storage.CAFile == "" || fileExists(c.Storage.CAFile), "storage CA file %q cannot be read", c.Storage.CAFile)
+	check(c.Storage.AccessKey != "" && c.Storage.SecretKey != "", "storage access and secret keys are required")
+	check(s3utils.CheckValidBucketNameStrict(c.Storage.Bucket) == nil, "storage bucket %q is not a valid bucket name", c.Storage.Bucket)
+
+	check(c.Auth.JWTSecret != "", "JWT secret is required")
+	check(!placeholderSecrets[c.Auth.JWTSecret], "JWT secret %q is a published example value; set a random secret", c.Auth.JWTSecret)
+	check(c.Auth.TokenTTL > 0, "token TTL must be positive")
+	check(c.Auth.PasswordResetTTL > 0, "password reset TTL must be positive")
+	check(c.Auth.ImpersonationTTL > 0, "impersonation TTL must be positive")
+
+	check(c.Mail.Port > 0 && c.Mail.Port <= 65535, "mail port must be between 1 and 65535")
+	check(c.Mail.Host == "" || c.Mail.From != "", "mail sender is required when a mail host is set")
+
+	check(c.Maintenance.TrashRetentionDays > 0, "trash retention must be at least 1 day")
+	check(c.Maintenance.LinkExpiryWarningHours > 0, "link expiry warning must be at least 1 hour")
+	check(c.Maintenance.ReconcileHours > 0, "storage reconciliation interval must be at least 1 hour")
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// fileExists reports whether path names a readable regular file
+func fileExists(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	return err == nil && info.Mode().IsRegular()
+}
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// collectionIndexes lists the indexes every collection needs, keyed by collection name
+var collectionIndexes = map[string][]mongo.IndexModel{
+	"files": {
+		{
+			// Full-text search over names, tags and descriptions, names weighted highest
+			Keys: bson.D{
+				{Key: "filename", Value: "text"},
+				{Key: "tags", Value: "text"},
+				{Key: "description", Value: "text"},
+			},
+			Options: options.Index().
+				SetName("files_text").
+				SetWeights(bson.D{
+					{Key: "filename", Value: 10},
+					{Key: "tags", Value: 5},
+					{Key: "description", Value: 1},
+				}),
+		},
+		{Keys: bson.D{{Key: "owner", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "team_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "shares.user_id", Value: 1}}},
+		// Storage reconciliation looks records up by object key
+		{Keys: bson.D{{Key: "object_key", Value: 1}}},
+	},
+	"upload_requests": {
+		{Keys: bson.D{{Key: "token", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "owner", Value: 1}, {Key: "created_at", Value: -1}}},
+	},
+	"access_logs": {
+		{Keys: bson.D{{Key: "file_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "file_id", Value: 1}, {Key: "link_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	},
+	"notifications": {
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	},
+	"notification_preferences": {
+		{Keys: bson.D{{Key: "user_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+	"webhooks": {
+		{Keys: bson.D{{Key: "owner", Value: 1}}},
+		{Keys: bson.D{{Key: "events", Value: 1}, {Key: "active", Value: 1}}},
+	},
+	"webhook_deliveries": {
+		{Keys: bson.D{{Key: "webhook_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+	},
+	"event_outbox": {
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+		// Finished events are kept for a week for inspection
+		{Keys: bson.D{{Key: "completed_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(7 * 24 * 60 * 60)},
+	},
+	"audit_log": {
+		// Unique so concurrent appends cannot fork the chain
+		{Keys: bson.D{{Key: "seq", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "action", Value: 1}, {Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "actor_id", Value: 1}, {Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "target_id", Value: 1}, {Key: "time", Value: -1}}},
+	},
+	"teams": {
+		{Keys: bson.D{{Key: "members.user_id", Value: 1}}},
+	},
+}
+
+// EnsureIndexes creates any missing indexes; existing indexes are left untouched
+func EnsureIndexes(database *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for name, models := range collectionIndexes {
+		if _, err := database.Collection(name).Indexes().CreateMany(ctx, models); err != nil {
+			return fmt.Errorf("failed to create indexes on %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
@@ -10,8 +10,11 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// MongoDB connection instance
-var MongoClient *mongo.Client
+// MongoDB connection instance and the configured database
+var (
+	MongoClient *mongo.Client
+	database    *mongo.Database
+)
 
 // ConnectMongoDB initializes the database connection and returns a reference to the database
 func ConnectMongoDB(uri string, dbName string) *mongo.Database {
@@ -32,12 +35,21 @@ func ConnectMongoDB(uri string, dbName string) *mongo.Database {
 
 	fmt.Println("✅ Connected to MongoDB")
 	MongoClient = client
+	database = client.Database(dbName)
 
 	// Return the database reference
-	return client.Database(dbName)
+	return database
+}
+
+// Collection returns a collection of the configured database
+func Collection(name string) *mongo.Collection {
+	return database.Collection(name)
 }
 
-// GetCollection returns a MongoDB collection
-func GetCollection(dbName, collectionName string) *mongo.Collection {
-	return MongoClient.Database(dbName).Collection(collectionName)
+// Disconnect closes the MongoDB connection
+func Disconnect(ctx context.Context) error {
+	if MongoClient == nil {
+		return nil
+	}
+	return MongoClient.Disconnect(ctx)
 }
@@ -0,0 +1,217 @@
+// Package events is an in-process publish/subscribe bus. Services publish
+// typed events; synchronous subscribers run before Publish returns, and
+// asynchronous subscribers run on background workers. Events with async
+// subscribers are first written to a Mongo outbox, so work interrupted by a
+// crash is picked up again after a restart.
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	queueSize     = 1024
+	workerCount   = 4
+	relayInterval = 5 * time.Second
+)
+
+// Event is a published payload with its identity and time
+type Event struct {
+	ID           string
+	Type         string
+	OccurredAt   time.Time
+	Payload      Payload
+	Impersonator string // Admin who caused the event while impersonating its actor
+}
+
+type impersonatorKey struct{}
+
+// WithImpersonator marks ctx as acting for an admin impersonating the user;
+// events published with it record the admin
+func WithImpersonator(ctx context.Context, adminID string) context.Context {
+	return context.WithValue(ctx, impersonatorKey{}, adminID)
+}
+
+// impersonatorFrom returns the admin set by WithImpersonator, "" when none
+func impersonatorFrom(ctx context.Context) string {
+	adminID, _ := ctx.Value(impersonatorKey{}).(string)
+	return adminID
+}
+
+// Handler reacts to an event; async handlers that fail are retried
+type Handler func(ctx context.Context, e Event) error
+
+type asyncSubscriber struct {
+	name    string
+	handler Handler
+}
+
+// job is an event together with the async subscribers still to run for it
+type job struct {
+	event       Event
+	subscribers []string
+}
+
+var (
+	mu        sync.RWMutex
+	syncSubs  = map[string][]Handler{}
+	asyncSubs = map[string][]asyncSubscriber{}
+
+	queue = make(chan job, queueSize)
+)
+
+// Subscribe runs h inside Publish for every event of the given type
+func Subscribe(eventType string, h Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	syncSubs[eventType] = append(syncSubs[eventType], h)
+}
+
+// SubscribeAsync runs h on a background worker for every event of the given
+// type. The name identifies the subscriber in the outbox and must be stable
+// across restarts and unique per event type.
+func SubscribeAsync(eventType, name string, h Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	asyncSubs[eventType] = append(asyncSubs[eventType], asyncSubscriber{name: name, handler: h})
+}
+
+// Publish stores the event in the outbox when it has async subscribers, runs
+// the sync subscribers and queues the async ones. Errors from sync subscribers
+// are returned joined; the event is published regardless.
+func Publish(ctx context.Context, p Payload) error {
+	e := Event{
+		ID:           primitive.NewObjectID().Hex(),
+		Type:         p.EventType(),
+		OccurredAt:   time.Now().UTC(),
+		Payload:      p,
+		Impersonator: impersonatorFrom(ctx),
+	}
+
+	mu.RLock()
+	handlers := syncSubs[e.Type]
+	names := make([]string, 0, len(asyncSubs[e.Type]))
+	for _, s := range asyncSubs[e.Type] {
+		names = append(names, s.name)
+	}
+	mu.RUnlock()
+
+	if len(names) > 0 {
+		if err := storeEvent(ctx, e, names); err != nil {
+			// Still try the async subscribers now, just without crash safety
+			log.Printf("Event %s (%s) not written to outbox: %v", e.ID, e.Type, err)
+		}
+	}
+
+	var errs []error
+	for _, h := range handlers {
+		if err := runHandler(ctx, h, e); err != nil {
+			errs = append(errs, fmt.Errorf("%s subscriber: %w", e.Type, err))
+		}
+	}
+
+	if len(names) > 0 {
+		select {
+		case queue <- job{event: e, subscribers: names}:
+		default:
+			// Queue full; the relay picks the event up from the outbox
+			log.Printf("Event queue full, deferring %s (%s) to the outbox relay", e.ID, e.Type)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Start runs the async workers and the outbox relay until ctx is cancelled
+func Start(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < workerCount; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case j := <-queue:
+					process(ctx, j)
+				}
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(relayInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case <-ticker.C:
+			relay(ctx)
+		}
+	}
+}
+
+// process runs an event's outstanding async subscribers and records the outcome
+func process(ctx context.Context, j job) {
+	mu.RLock()
+	subs := asyncSubs[j.event.Type]
+	mu.RUnlock()
+
+	var failed []string
+	var lastErr error
+	for _, name := range j.subscribers {
+		for _, s := range subs {
+			if s.name != name {
+				continue
+			}
+			if err := runHandler(ctx, s.handler, j.event); err != nil {
+				log.Printf("Event %s (%s): subscriber %s failed: %v", j.event.ID, j.event.Type, name, err)
+				failed = append(failed, name)
+				lastErr = err
+			}
+		}
+	}
+
+	if err := completeEvent(ctx, j.event.ID, failed, lastErr); err != nil {
+		log.Printf("Event %s (%s): failed to update outbox: %v", j.event.ID, j.event.Type, err)
+	}
+}
+
+// runHandler calls a subscriber, turning a panic into an error so one bad
+// subscriber cannot take down a worker or the publishing request
+func runHandler(ctx context.Context, h Handler, e Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return h(ctx, e)
+}
+
+// relay queues outbox events whose subscribers are due to run again
+func relay(ctx context.Context) {
+	for {
+		j, ok, err := claimEvent(ctx)
+		if err != nil {
+			log.Printf("Outbox relay failed: %v", err)
+			return
+		}
+		if !ok {
+			return
+		}
+		select {
+		case queue <- j:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
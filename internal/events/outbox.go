@@ -0,0 +1,164 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/arzan03/SecureShare/internal/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	outboxLease       = time.Minute // How long a queued event may take before the relay runs it again
+	outboxMaxAttempts = 8
+	outboxBaseBackoff = 10 * time.Second
+	outboxMaxBackoff  = 30 * time.Minute
+)
+
+// Outbox states
+const (
+	statusPending = "pending"
+	statusDone    = "done"
+	statusFailed  = "failed"
+)
+
+// outboxEntry is an event as stored in Mongo, with the async subscribers still to run
+type outboxEntry struct {
+	ID            string     `bson:"_id"`
+	Type          string     `bson:"type"`
+	Payload       bson.Raw   `bson:"payload"`
+	Impersonator  string     `bson:"impersonator,omitempty"`
+	OccurredAt    time.Time  `bson:"occurred_at"`
+	Pending       []string   `bson:"pending"`
+	Status        string     `bson:"status"`
+	Attempts      int        `bson:"attempts"`
+	NextAttemptAt time.Time  `bson:"next_attempt_at,omitempty"`
+	LastError     string     `bson:"last_error,omitempty"`
+	CompletedAt   *time.Time `bson:"completed_at,omitempty"`
+}
+
+func outbox() *mongo.Collection {
+	return db.Collection("event_outbox")
+}
+
+// storeEvent writes an event to the outbox before its subscribers run
+func storeEvent(ctx context.Context, e Event, subscribers []string) error {
+	payload, err := bson.Marshal(e.Payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	_, err = outbox().InsertOne(ctx, outboxEntry{
+		ID:            e.ID,
+		Type:          e.Type,
+		Payload:       payload,
+		Impersonator:  e.Impersonator,
+		OccurredAt:    e.OccurredAt,
+		Pending:       subscribers,
+		Status:        statusPending,
+		NextAttemptAt: time.Now().Add(outboxLease),
+	})
+	return err
+}
+
+// backoff returns the wait before an event's next attempt, doubling each time
+func backoff(attempts int) time.Duration {
+	d := outboxBaseBackoff << (attempts - 1)
+	if d <= 0 || d > outboxMaxBackoff {
+		return outboxMaxBackoff
+	}
+	return d
+}
+
+// completeEvent records which subscribers still have to run for an event and
+// schedules a retry for them, or marks the event done
+func completeEvent(ctx context.Context, id string, failed []string, lastErr error) error {
+	now := time.Now()
+
+	if len(failed) == 0 {
+		_, err := outbox().UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+			"$set":   bson.M{"status": statusDone, "pending": []string{}, "completed_at": now},
+			"$unset": bson.M{"next_attempt_at": "", "last_error": ""},
+		})
+		return err
+	}
+
+	var entry outboxEntry
+	err := outbox().FindOneAndUpdate(ctx, bson.M{"_id": id},
+		bson.M{
+			"$set": bson.M{"pending": failed, "last_error": lastErr.Error()},
+			"$inc": bson.M{"attempts": 1},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&entry)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil // Never made it into the outbox
+	}
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{"$set": bson.M{"next_attempt_at": now.Add(backoff(entry.Attempts))}}
+	if entry.Attempts >= outboxMaxAttempts {
+		update = bson.M{
+			"$set":   bson.M{"status": statusFailed, "completed_at": now},
+			"$unset": bson.M{"next_attempt_at": ""},
+		}
+	}
+	_, err = outbox().UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// claimEvent takes the next due outbox event by pushing its next attempt a
+// lease into the future. ok is false when nothing is due.
+func claimEvent(ctx context.Context) (j job, ok bool, err error) {
+	for {
+		now := time.Now()
+
+		var entry outboxEntry
+		err = outbox().FindOneAndUpdate(ctx,
+			bson.M{"status": statusPending, "next_attempt_at": bson.M{"$lte": now}},
+			bson.M{"$set": bson.M{"next_attempt_at": now.Add(outboxLease)}},
+			options.FindOneAndUpdate().SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}),
+		).Decode(&entry)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return job{}, false, nil
+		}
+		if err != nil {
+			return job{}, false, err
+		}
+
+		payload, err := decodePayload(entry)
+		if err != nil {
+			// Retrying cannot fix an undecodable event, so give up on it
+			outbox().UpdateOne(ctx, bson.M{"_id": entry.ID}, bson.M{
+				"$set":   bson.M{"status": statusFailed, "last_error": err.Error(), "completed_at": now},
+				"$unset": bson.M{"next_attempt_at": ""},
+			})
+			continue
+		}
+
+		return job{
+			event: Event{ID: entry.ID, Type: entry.Type, OccurredAt: entry.OccurredAt, Payload: payload,
+				Impersonator: entry.Impersonator},
+			subscribers: entry.Pending,
+		}, true, nil
+	}
+}
+
+// decodePayload rebuilds an outbox entry's typed payload
+func decodePayload(entry outboxEntry) (Payload, error) {
+	decode, known := decoders[entry.Type]
+	if !known {
+		return nil, fmt.Errorf("unknown event type %q", entry.Type)
+	}
+	payload, err := decode(entry.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode payload: %w", err)
+	}
+	return payload, nil
+}
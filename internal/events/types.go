@@ -0,0 +1,230 @@
+package events
+
+import (
+	"time"
+
+	"github.com/arzan03/SecureShare/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Event types
+const (
+	TypeFileUploaded    = models.EventFileUploaded
+	TypeFileDeleted     = models.EventFileDeleted
+	TypeFileExpired     = models.EventFileExpired
+	TypeLinkCreated     = models.EventLinkCreated
+	TypeLinkRedeemed    = models.EventLinkRedeemed
+	TypeUserRegistered  = "user.registered"
+	TypeUserLoggedIn    = "user.logged_in"
+	TypeUserLoginFailed = "user.login_failed"
+	TypeFileShared      = "file.shared"
+	TypeShareRevoked    = "file.share_revoked"
+	TypeFileDownloaded  = "file.downloaded"
+	TypeFileTransferred = "file.transferred"
+
+	TypeUserSuspended       = "user.suspended"
+	TypeUserReactivated     = "user.reactivated"
+	TypeUserRoleChanged     = "user.role_changed"
+	TypePasswordResetForced = "user.password_reset_forced"
+	TypePasswordReset       = "user.password_reset"
+	TypeUserDeleted         = "user.deleted"
+	TypeUserImpersonated    = "user.impersonated"
+)
+
+// Payload is the typed body of an event
+type Payload interface {
+	EventType() string
+}
+
+// FileUploaded is published once a new file is stored
+type FileUploaded struct {
+	File       models.File `bson:"file"`
+	ActorID    string      `bson:"actor_id,omitempty"`    // Who created it, when not the owner uploading
+	CopiedFrom string      `bson:"copied_from,omitempty"` // Source file ID when created by a copy
+}
+
+// FileDeleted is published when a file is moved to the trash, and again when it is purged
+type FileDeleted struct {
+	File      models.File `bson:"file"`
+	ActorID   string      `bson:"actor_id,omitempty"` // Empty when purged by retention
+	Permanent bool        `bson:"permanent"`
+}
+
+// FileExpired is published once when a file passes its expiry time
+type FileExpired struct {
+	File models.File `bson:"file"`
+}
+
+// LinkCreated is published when a share link is generated for a file
+type LinkCreated struct {
+	File        models.File `bson:"file"` // Carries the new link's fields
+	ActorID     string      `bson:"actor_id"`
+	AdminAccess bool        `bson:"admin_access,omitempty"` // Created by an admin without access of their own
+}
+
+// FileShared is published when a user is granted access to a file
+type FileShared struct {
+	File    models.File      `bson:"file"`
+	ActorID string           `bson:"actor_id"`
+	Share   models.FileShare `bson:"share"`
+}
+
+// ShareRevoked is published when a user's access grant is removed
+type ShareRevoked struct {
+	File    models.File `bson:"file"`
+	ActorID string      `bson:"actor_id"`
+	UserID  string      `bson:"user_id"`
+}
+
+// FileDownloaded is published when a signed-in user with access fetches a file directly
+type FileDownloaded struct {
+	File        models.File `bson:"file"`
+	UserID      string      `bson:"user_id"`
+	AdminAccess bool        `bson:"admin_access,omitempty"` // Downloaded by an admin without access of their own
+}
+
+// FileTransferred is published when a file is handed to another user or moved into a team
+type FileTransferred struct {
+	File          models.File `bson:"file"` // As it is after the transfer
+	ActorID       string      `bson:"actor_id"`
+	PreviousOwner string      `bson:"previous_owner"`
+}
+
+// LinkRedeemed is published when a share link is used to download a file
+type LinkRedeemed struct {
+	File      models.File `bson:"file"`
+	UserID    string      `bson:"user_id,omitempty"`
+	IP        string      `bson:"ip"`
+	UserAgent string      `bson:"user_agent,omitempty"`
+}
+
+// UserRegistered is published when an account is created
+type UserRegistered struct {
+	UserID string `bson:"user_id"`
+	Email  string `bson:"email"`
+	IP     string `bson:"ip,omitempty"`
+}
+
+// UserLoggedIn is published after a successful login
+type UserLoggedIn struct {
+	UserID string `bson:"user_id"`
+	Email  string `bson:"email"`
+	IP     string `bson:"ip,omitempty"`
+}
+
+// UserLoginFailed is published when a login is refused
+type UserLoginFailed struct {
+	Email  string `bson:"email"`
+	Reason string `bson:"reason"`
+	IP     string `bson:"ip,omitempty"`
+}
+
+// UserSuspended is published when an admin suspends an account
+type UserSuspended struct {
+	UserID  string `bson:"user_id"`
+	Email   string `bson:"email"`
+	ActorID string `bson:"actor_id"`
+	Reason  string `bson:"reason,omitempty"`
+}
+
+// UserReactivated is published when an admin lifts a suspension
+type UserReactivated struct {
+	UserID  string `bson:"user_id"`
+	Email   string `bson:"email"`
+	ActorID string `bson:"actor_id"`
+}
+
+// UserRoleChanged is published when an admin changes an account's role
+type UserRoleChanged struct {
+	UserID  string `bson:"user_id"`
+	Email   string `bson:"email"`
+	ActorID string `bson:"actor_id"`
+	OldRole string `bson:"old_role"`
+	NewRole string `bson:"new_role"`
+}
+
+// PasswordResetForced is published when an admin requires a user to choose a new password
+type PasswordResetForced struct {
+	UserID  string `bson:"user_id"`
+	Email   string `bson:"email"`
+	ActorID string `bson:"actor_id"`
+}
+
+// PasswordReset is published when a user sets a new password with a reset token
+type PasswordReset struct {
+	UserID string `bson:"user_id"`
+	Email  string `bson:"email"`
+	IP     string `bson:"ip,omitempty"`
+}
+
+// UserDeleted is published once an account and its data have been removed
+type UserDeleted struct {
+	UserID       string `bson:"user_id"`
+	Email        string `bson:"email"`
+	ActorID      string `bson:"actor_id"`
+	FilesDeleted int    `bson:"files_deleted"`
+}
+
+// UserImpersonated is published when an admin is issued a token acting as a user
+type UserImpersonated struct {
+	UserID    string    `bson:"user_id"`
+	Email     string    `bson:"email"`
+	ActorID   string    `bson:"actor_id"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+func (FileUploaded) EventType() string    { return TypeFileUploaded }
+func (FileDeleted) EventType() string     { return TypeFileDeleted }
+func (FileExpired) EventType() string     { return TypeFileExpired }
+func (LinkCreated) EventType() string     { return TypeLinkCreated }
+func (LinkRedeemed) EventType() string    { return TypeLinkRedeemed }
+func (UserRegistered) EventType() string  { return TypeUserRegistered }
+func (UserLoggedIn) EventType() string    { return TypeUserLoggedIn }
+func (UserLoginFailed) EventType() string { return TypeUserLoginFailed }
+func (FileShared) EventType() string      { return TypeFileShared }
+func (ShareRevoked) EventType() string    { return TypeShareRevoked }
+func (FileDownloaded) EventType() string  { return TypeFileDownloaded }
+func (FileTransferred) EventType() string { return TypeFileTransferred }
+
+func (UserSuspended) EventType() string       { return TypeUserSuspended }
+func (UserReactivated) EventType() string     { return TypeUserReactivated }
+func (UserRoleChanged) EventType() string     { return TypeUserRoleChanged }
+func (PasswordResetForced) EventType() string { return TypePasswordResetForced }
+func (PasswordReset) EventType() string       { return TypePasswordReset }
+func (UserDeleted) EventType() string         { return TypeUserDeleted }
+func (UserImpersonated) EventType() string    { return TypeUserImpersonated }
+
+// decoders rebuild typed payloads from the outbox, keyed by event type
+var decoders = map[string]func(bson.Raw) (Payload, error){}
+
+// register makes a payload type decodable from the outbox
+func register[T Payload]() {
+	var zero T
+	decoders[zero.EventType()] = func(raw bson.Raw) (Payload, error) {
+		var p T
+		err := bson.Unmarshal(raw, &p)
+		return p, err
+	}
+}
+
+func init() {
+	register[FileUploaded]()
+	register[FileDeleted]()
+	register[FileExpired]()
+	register[LinkCreated]()
+	register[LinkRedeemed]()
+	register[UserRegistered]()
+	register[UserLoggedIn]()
+	register[UserLoginFailed]()
+	register[FileShared]()
+	register[ShareRevoked]()
+	register[FileDownloaded]()
+	register[FileTransferred]()
+	register[UserSuspended]()
+	register[UserReactivated]()
+	register[UserRoleChanged]()
+	register[PasswordResetForced]()
+	register[PasswordReset]()
+	register[UserDeleted]()
+	register[UserImpersonated]()
+}
@@ -1,90 +1,274 @@
 package handlers
 
 import (
-	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
+	"github.com/arzan03/SecureShare/internal/services"
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-var userCollection *mongo.Collection
-var fileCollection *mongo.Collection
-
-// Initialize MongoDB collections
-func InitAdminHandler(db *mongo.Database) {
-	userCollection = db.Collection("users")
-	fileCollection = db.Collection("files")
-}
-
-// List all users
+// List users a page at a time (?limit=&offset=&email=), with their usage and account state
 func ListUsers(c *fiber.Ctx) error {
-	var users []bson.M
-	cursor, err := userCollection.Find(context.TODO(), bson.M{})
+	page, err := services.ListUsersForAdmin(c.Query("email"), int64(c.QueryInt("offset")), int64(c.QueryInt("limit", services.DefaultPageSize)))
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch users"})
 	}
-	defer cursor.Close(context.TODO())
-	cursor.All(context.TODO(), &users)
-	return c.JSON(users)
+	return c.JSON(page)
 }
 
-// List all uploaded files
+// List all uploaded files, a page at a time; ?trashed=true lists the trashed ones
 func ListAllFiles(c *fiber.Ctx) error {
-	var files []bson.M
-	cursor, err := fileCollection.Find(context.TODO(), bson.M{})
+	opts, err := parseFileListOptions(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	page, err := services.ListFiles(bson.M{"deleted_at": bson.M{"$exists": c.QueryBool("trashed")}}, opts)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch files"})
+		return c.Status(listErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
 	}
-	defer cursor.Close(context.TODO())
-	cursor.All(context.TODO(), &files)
-	return c.JSON(files)
+	return c.JSON(page)
 }
 
-// Get all files uploaded by a specific user
+// List the files a user uploaded, a page at a time, with the usual listing filters; ?trashed=true lists their trash
 func ListUserFiles(c *fiber.Ctx) error {
-	userID := c.Params("user_id")
-	var files []bson.M
-	cursor, err := fileCollection.Find(context.TODO(), bson.M{"user_id": userID})
+	opts, err := parseFileListOptions(c)
 	if err != nil {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to fetch user files"})
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
-	defer cursor.Close(context.TODO())
-	cursor.All(context.TODO(), &files)
-	return c.JSON(files)
+
+	base := bson.M{"owner": c.Params("userid"), "deleted_at": bson.M{"$exists": c.QueryBool("trashed")}}
+	page, err := services.ListFiles(base, opts)
+	if err != nil {
+		return c.Status(listErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(page)
 }
 
-// Get user details by ID
-func GetUserByID(c *fiber.Ctx) error {
-	userID := c.Params("userid")
+// Create a share link for any file for support cases; ?replace=true replaces a link the owner still has out
+func AdminGenerateLinkHandler(c *fiber.Ctx) error {
+	adminID := c.Locals("user_id").(string)
+
+	var requestBody struct {
+		TokenType string `json:"token_type"`
+		Duration  int    `json:"duration,omitempty"` // Minutes
+		services.LinkRestrictions
+	}
+	if err := c.BodyParser(&requestBody); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
 
-	// Convert string userID to MongoDB ObjectID
-	objID, err := primitive.ObjectIDFromHex(userID)
+	if requestBody.TokenType != "one-time" && requestBody.TokenType != "time-limited" {
+		requestBody.TokenType = "time-limited"
+	}
+	duration := time.Duration(requestBody.Duration) * time.Minute
+	if requestBody.TokenType == "one-time" || requestBody.Duration <= 0 {
+		duration = 30 * time.Minute
+	}
+
+	presignedURL, err := services.AdminGeneratePresignedURL(c.Params("file_id"), adminID, requestBody.TokenType, duration, requestBody.LinkRestrictions, c.QueryBool("replace"))
 	if err != nil {
-		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid user ID format"})
+		return c.Status(fileErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
 	}
+	return c.JSON(fiber.Map{
+		"presigned_url": presignedURL,
+		"expires_in":    fmt.Sprintf("%d minutes", int(duration.Minutes())),
+	})
+}
 
-	var user bson.M
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// Get a short-lived download link for any file for support cases
+func AdminDownloadFileHandler(c *fiber.Ctx) error {
+	adminID := c.Locals("user_id").(string)
 
-	err = userCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&user)
+	downloadURL, err := services.AdminGetDownloadURL(c.Params("file_id"), adminID)
 	if err != nil {
-		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		return c.Status(fileErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
 	}
+	return c.JSON(fiber.Map{
+		"download_url": downloadURL,
+		"expires_in":   "10 minutes",
+	})
+}
 
+// Get user details by ID
+func GetUserByID(c *fiber.Ctx) error {
+	user, err := services.GetUserForAdmin(c.Params("userid"))
+	if err != nil {
+		return c.Status(userAdminErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
 	return c.JSON(user)
 }
 
-// Force delete a file (Admin Only)
+// adminUserResponse answers an account management action with the user's updated admin view
+func adminUserResponse(c *fiber.Ctx, message, userID string) error {
+	user, err := services.GetUserForAdmin(userID)
+	if err != nil {
+		return c.Status(userAdminErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": message, "user": user})
+}
+
+// Permanently delete any file and its stored object (Admin Only); ?dry_run=true only reports it
 func AdminDeleteFile(c *fiber.Ctx) error {
-	fileID := c.Params("file_id")
-	result, err := fileCollection.DeleteOne(context.TODO(), bson.M{"_id": fileID})
-	if err != nil || result.DeletedCount == 0 {
-		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete file"})
+	adminID := c.Locals("user_id").(string)
+	dryRun := c.QueryBool("dry_run")
+
+	file, err := services.AdminDeleteFile(adminID, c.Params("file_id"), dryRun)
+	if err != nil {
+		return c.Status(fileErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	message := "File deleted successfully"
+	if dryRun {
+		message = "Dry run: file would be deleted"
+	}
+	return c.JSON(fiber.Map{"message": message, "file": file, "dry_run": dryRun})
+}
+
+// Permanently delete every file matching a filter (Admin Only)
+func AdminBulkDeleteFiles(c *fiber.Ctx) error {
+	adminID := c.Locals("user_id").(string)
+
+	var filter services.BulkDeleteFilter
+	if err := c.BodyParser(&filter); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	result, err := services.AdminBulkDelete(adminID, filter)
+	if errors.Is(err, services.ErrEmptyBulkFilter) || errors.Is(err, services.ErrInvalidBulkFilter) {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(result)
+}
+
+// System statistics for the admin dashboard; ?top= sizes the rankings, ?days= the upload history
+func AdminStatsHandler(c *fiber.Ctx) error {
+	stats, err := services.GetSystemStats(services.StatsQuery{Top: c.QueryInt("top"), Days: c.QueryInt("days")})
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(stats)
+}
+
+// Start comparing the bucket with the file records in the background; ?repair=true removes the orphans it finds
+func ReconcileStorageHandler(c *fiber.Ctx) error {
+	adminID := c.Locals("user_id").(string)
+
+	err := services.StartReconcile(adminID, c.QueryBool("repair"))
+	if errors.Is(err, services.ErrReconcileRunning) {
+		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(http.StatusAccepted).JSON(fiber.Map{"message": "Storage reconciliation started"})
+}
+
+// Progress of the running storage reconciliation and the report of the last one
+func ReconcileStatusHandler(c *fiber.Ctx) error {
+	status, ok := services.GetReconcileStatus()
+	if !ok {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "No reconciliation has run since the server started"})
+	}
+	return c.JSON(status)
+}
+
+// userAdminErrorStatus maps account management errors to HTTP status codes
+func userAdminErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrCannotModifySelf), errors.Is(err, services.ErrCannotImpersonate),
+		errors.Is(err, services.ErrAccountSuspended):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrInvalidRole):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrSoleTeamOwner):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Suspend a user's account
+func SuspendUserHandler(c *fiber.Ctx) error {
+	adminID := c.Locals("user_id").(string)
+
+	var request struct {
+		Reason string `json:"reason"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+	}
+
+	if _, err := services.SuspendUser(adminID, c.Params("userid"), request.Reason); err != nil {
+		return c.Status(userAdminErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return adminUserResponse(c, "User suspended", c.Params("userid"))
+}
+
+// Reactivate a suspended account
+func ReactivateUserHandler(c *fiber.Ctx) error {
+	adminID := c.Locals("user_id").(string)
+
+	if _, err := services.ReactivateUser(adminID, c.Params("userid")); err != nil {
+		return c.Status(userAdminErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return adminUserResponse(c, "User reactivated", c.Params("userid"))
+}
+
+// Change a user's role
+func ChangeUserRoleHandler(c *fiber.Ctx) error {
+	adminID := c.Locals("user_id").(string)
+
+	var request struct {
+		Role string `json:"role"`
+	}
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if _, err := services.ChangeUserRole(adminID, c.Params("userid"), request.Role); err != nil {
+		return c.Status(userAdminErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return adminUserResponse(c, "Role updated", c.Params("userid"))
+}
+
+// Require a user to choose a new password before logging in again
+func ForcePasswordResetHandler(c *fiber.Ctx) error {
+	adminID := c.Locals("user_id").(string)
+
+	if err := services.ForcePasswordReset(adminID, c.Params("userid")); err != nil {
+		return c.Status(userAdminErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "Password reset required; the user has been emailed a reset token"})
+}
+
+// Issue a short-lived token acting as a user, for support
+func ImpersonateUserHandler(c *fiber.Ctx) error {
+	adminID := c.Locals("user_id").(string)
+	userID := c.Params("userid")
+
+	token, expires, err := services.ImpersonateUser(adminID, userID)
+	if err != nil {
+		return c.Status(userAdminErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"token": token, "expires_at": expires, "impersonating": userID})
+}
+
+// Delete a user and all of their data
+func DeleteUserHandler(c *fiber.Ctx) error {
+	adminID := c.Locals("user_id").(string)
+
+	deleted, err := services.DeleteUser(adminID, c.Params("userid"))
+	if err != nil {
+		return c.Status(userAdminErrorStatus(err)).JSON(fiber.Map{"error": err.Error(), "files_deleted": deleted})
 	}
-	return c.JSON(fiber.Map{"message": "File deleted successfully"})
+	return c.JSON(fiber.Map{"message": "User deleted", "files_deleted": deleted})
 }
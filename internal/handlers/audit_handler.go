@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/arzan03/SecureShare/internal/audit"
+	"github.com/arzan03/SecureShare/internal/models"
+	"github.com/arzan03/SecureShare/internal/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+// parseAuditFilter reads the audit log filters from the query string
+func parseAuditFilter(c *fiber.Ctx) (audit.Filter, error) {
+	f := audit.Filter{
+		Action:       c.Query("action"),
+		ActorID:      c.Query("actor"),
+		Impersonator: c.Query("impersonator"),
+		TargetID:     c.Query("target"),
+	}
+	if v := c.Query("since"); v != "" {
+		t, err := parseTimeParam(v)
+		if err != nil {
+			return f, errors.New("since must be a date or RFC3339 timestamp")
+		}
+		f.Since = t
+	}
+	if v := c.Query("until"); v != "" {
+		t, err := parseTimeParam(v)
+		if err != nil {
+			return f, errors.New("until must be a date or RFC3339 timestamp")
+		}
+		f.Until = t
+	}
+	if v := c.Query("after_seq"); v != "" {
+		seq, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || seq < 0 {
+			return f, errors.New("after_seq must be a non-negative integer")
+		}
+		f.AfterSeq = seq
+	}
+	return f, nil
+}
+
+// ListAuditLogHandler returns audit entries in chain order; page with after_seq
+func ListAuditLogHandler(c *fiber.Ctx) error {
+	f, err := parseAuditFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	limit := c.QueryInt("limit", services.DefaultPageSize)
+	if limit <= 0 || limit > services.MaxPageSize {
+		limit = services.DefaultPageSize
+	}
+
+	entries, err := audit.Query(context.TODO(), f, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	response := fiber.Map{"entries": entries}
+	if len(entries) == limit {
+		response["next_after_seq"] = entries[len(entries)-1].Seq
+	}
+	return c.JSON(response)
+}
+
+// ExportAuditLogHandler streams every matching entry as JSON lines or CSV
+func ExportAuditLogHandler(c *fiber.Ctx) error {
+	f, err := parseAuditFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	format := c.Query("format", "jsonl")
+	switch format {
+	case "jsonl":
+		c.Set(fiber.HeaderContentType, "application/x-ndjson")
+	case "csv":
+		c.Set(fiber.HeaderContentType, "text/csv")
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "format must be jsonl or csv"})
+	}
+	filename := "audit-" + time.Now().UTC().Format("20060102T150405Z") + "." + format
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		var err error
+		if format == "csv" {
+			err = writeAuditCSV(w, f)
+		} else {
+			enc := json.NewEncoder(w)
+			err = audit.Each(context.TODO(), f, func(e models.AuditEntry) error {
+				return enc.Encode(e)
+			})
+		}
+		if err != nil {
+			log.Printf("Audit export failed: %v", err)
+		}
+		w.Flush()
+	})
+	return nil
+}
+
+// writeAuditCSV writes matching entries as CSV, with details as a JSON column
+func writeAuditCSV(w *bufio.Writer, f audit.Filter) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"seq", "time", "action", "actor_id", "actor_email", "impersonator", "target_type", "target_id", "ip", "details", "prev_hash", "hash"})
+
+	err := audit.Each(context.TODO(), f, func(e models.AuditEntry) error {
+		details := ""
+		if len(e.Details) > 0 {
+			data, _ := json.Marshal(e.Details)
+			details = string(data)
+		}
+		return cw.Write([]string{
+			strconv.FormatInt(e.Seq, 10), e.Time.UTC().Format(time.RFC3339Nano), e.Action,
+			e.ActorID, e.ActorEmail, e.Impersonator, e.TargetType, e.TargetID, e.IP, details, e.PrevHash, e.Hash,
+		})
+	})
+	cw.Flush()
+	if err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// VerifyAuditLogHandler checks the whole hash chain and reports any breaks
+func VerifyAuditLogHandler(c *fiber.Ctx) error {
+	report, err := audit.Verify(context.TODO())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(report)
+}
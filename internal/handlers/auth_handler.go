@@ -1,6 +1,9 @@
 package handlers
 
 import (
+	"errors"
+
+	"github.com/arzan03/SecureShare/internal/middleware"
 	"github.com/arzan03/SecureShare/internal/services"
 	"github.com/gofiber/fiber/v2"
 )
@@ -16,7 +19,7 @@ func RegisterHandler(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
-	user, err := services.RegisterUser(request.Email, request.Password, request.Role)
+	user, err := services.RegisterUser(request.Email, request.Password, request.Role, middleware.ClientIP(c))
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -34,7 +37,10 @@ func LoginHandler(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
-	token, err := services.LoginUser(request.Email, request.Password)
+	token, err := services.LoginUser(request.Email, request.Password, middleware.ClientIP(c))
+	if errors.Is(err, services.ErrAccountSuspended) || errors.Is(err, services.ErrPasswordResetRequired) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -43,3 +49,21 @@ func LoginHandler(c *fiber.Ctx) error {
 		"token": token,
 	})
 }
+
+// ResetPasswordHandler sets a new password with a token from an admin-forced reset
+func ResetPasswordHandler(c *fiber.Ctx) error {
+	var request struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := services.ResetPassword(request.Token, request.Password, middleware.ClientIP(c)); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "Password updated, please log in"})
+}
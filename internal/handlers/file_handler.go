@@ -1,16 +1,15 @@
 package handlers
 
 import (
-	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/arzan03/SecureShare/internal/models"
+	"github.com/arzan03/SecureShare/internal/middleware"
 	"github.com/arzan03/SecureShare/internal/services"
 	"github.com/gofiber/fiber/v2"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // UploadFileHandler handles file uploads
@@ -19,7 +18,7 @@ func UploadFileHandler(c *fiber.Ctx) error {
 
 	fileData, err := services.UploadFile(c, userID)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		return c.Status(teamErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
 	}
 
 	return c.JSON(fiber.Map{
@@ -39,6 +38,7 @@ func BatchPresignedURLHandler(c *fiber.Ctx) error {
 		FileIDs   []string `json:"file_ids"`
 		TokenType string   `json:"token_type"`
 		Duration  int      `json:"duration,omitempty"`
+		services.LinkRestrictions
 	}
 
 	if err := c.BodyParser(&requestBody); err != nil {
@@ -58,7 +58,7 @@ func BatchPresignedURLHandler(c *fiber.Ctx) error {
 		duration = 30 * time.Minute
 	}
 
-	urls, errs := services.BatchGeneratePresignedURLs(requestBody.FileIDs, userID, requestBody.TokenType, duration)
+	urls, errs := services.BatchGeneratePresignedURLs(c.UserContext(), requestBody.FileIDs, userID, requestBody.TokenType, duration, requestBody.LinkRestrictions)
 
 	return c.JSON(fiber.Map{
 		"presigned_urls": urls,
@@ -80,6 +80,7 @@ func GeneratePresignedURLHandler(c *fiber.Ctx) error {
 		FileIDs   []string `json:"file_ids"`
 		TokenType string   `json:"token_type"`
 		Duration  int      `json:"duration,omitempty"`
+		services.LinkRestrictions
 	}
 
 	if err := c.BodyParser(&requestBody); err != nil {
@@ -100,7 +101,7 @@ func GeneratePresignedURLHandler(c *fiber.Ctx) error {
 	// Determine if it's a batch request or single file request
 	if len(requestBody.FileIDs) > 0 {
 		// Batch processing
-		urls, errs := services.BatchGeneratePresignedURLs(requestBody.FileIDs, userID, requestBody.TokenType, duration)
+		urls, errs := services.BatchGeneratePresignedURLs(c.UserContext(), requestBody.FileIDs, userID, requestBody.TokenType, duration, requestBody.LinkRestrictions)
 		return c.JSON(fiber.Map{
 			"presigned_urls": urls,
 			"errors":         errs,
@@ -117,9 +118,9 @@ func GeneratePresignedURLHandler(c *fiber.Ctx) error {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "No file ID provided"})
 		}
 
-		presignedURL, err := services.GeneratePresignedURL(fileID, userID, requestBody.TokenType, duration)
+		presignedURL, err := services.GeneratePresignedURL(c.UserContext(), fileID, userID, requestBody.TokenType, duration, requestBody.LinkRestrictions)
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+			return c.Status(fileErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
 		}
 
 		return c.JSON(fiber.Map{
@@ -136,7 +137,16 @@ func ValidateDownloadHandler(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Missing download token"})
 	}
 
-	downloadURL, err := services.ValidateDownload(fileID, token)
+	userID, _ := c.Locals("user_id").(string)
+	downloadURL, err := services.ValidateDownload(c.UserContext(), fileID, token, services.DownloadClient{
+		UserID:    userID,
+		IP:        middleware.ClientIP(c), // Honours X-Forwarded-For only from TRUSTED_PROXIES
+		Referer:   c.Get(fiber.HeaderReferer),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+	})
+	if errors.Is(err, services.ErrLinkRestricted) || errors.Is(err, services.ErrLinkNotYetAvailable) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -147,21 +157,214 @@ func ValidateDownloadHandler(c *fiber.Ctx) error {
 	})
 }
 
-// ListUserFilesHandler gets all files uploaded by user using parallel metadata fetching
+// RescheduleLinkHandler moves or lifts the embargo on a file's share link
+func RescheduleLinkHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	var body struct {
+		NotBefore string `json:"not_before"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	// An empty time releases the link immediately
+	var notBefore time.Time
+	if body.NotBefore != "" {
+		var err error
+		if notBefore, err = time.Parse(time.RFC3339, body.NotBefore); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "not_before must be an RFC3339 timestamp"})
+		}
+	}
+
+	file, err := services.RescheduleLink(c.Params("id"), userID, notBefore)
+	if errors.Is(err, services.ErrNoActiveLink) || errors.Is(err, services.ErrLinkNotEmbargoed) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fileErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":       "Share link rescheduled",
+		"not_before":    file.TokenNotBefore,
+		"token_expires": file.TokenExpires,
+	})
+}
+
+// ListLinkRejectionsHandler lists refused attempts to redeem a file's share links
+func ListLinkRejectionsHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	rejections, err := services.ListLinkRejections(c.Params("id"), userID, c.QueryInt("limit"))
+	if err != nil {
+		return c.Status(fileErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"rejections": rejections})
+}
+
+// parseAccessQuery reads the interval, since and limit query parameters of the access endpoints
+func parseAccessQuery(c *fiber.Ctx) (services.AccessQuery, error) {
+	q := services.AccessQuery{Interval: c.Query("interval"), Limit: c.QueryInt("limit")}
+	if v := c.Query("since"); v != "" {
+		t, err := parseTimeParam(v)
+		if err != nil {
+			return q, errors.New("since must be a date or RFC3339 timestamp")
+		}
+		q.Since = t
+	}
+	return q, nil
+}
+
+// FileAccessHandler summarizes downloads of a file through any of its share links
+func FileAccessHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	q, err := parseAccessQuery(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	summary, err := services.GetFileAccessSummary(c.Params("id"), userID, q)
+	if err != nil {
+		return c.Status(fileErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(summary)
+}
+
+// LinkAccessHandler summarizes downloads through one share link
+func LinkAccessHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	q, err := parseAccessQuery(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	summary, err := services.GetLinkAccessSummary(c.Params("id"), c.Params("link_id"), userID, q)
+	if err != nil {
+		return c.Status(fileErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(summary)
+}
+
+// parseTimeParam accepts either RFC3339 timestamps or plain dates
+func parseTimeParam(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// parseFileListOptions reads pagination, sorting and filter query parameters
+func parseFileListOptions(c *fiber.Ctx) (services.FileListOptions, error) {
+	opts := services.FileListOptions{
+		SortBy:      c.Query("sort"),
+		Descending:  c.Query("order") == "desc",
+		Limit:       int64(c.QueryInt("limit", services.DefaultPageSize)),
+		Cursor:      c.Query("cursor"),
+		Name:        c.Query("name"),
+		ContentType: c.Query("content_type"),
+	}
+
+	// Tags may be repeated (?tag=a&tag=b) or comma separated (?tag=a,b)
+	for _, v := range c.Context().QueryArgs().PeekMulti("tag") {
+		opts.Tags = append(opts.Tags, strings.Split(string(v), ",")...)
+	}
+
+	// Metadata filters are passed as meta.<key>=<value>
+	for key, value := range c.Queries() {
+		if strings.HasPrefix(key, "meta.") {
+			if opts.Metadata == nil {
+				opts.Metadata = make(map[string]string)
+			}
+			opts.Metadata[strings.TrimPrefix(key, "meta.")] = value
+		}
+	}
+
+	if v := c.Query("created_after"); v != "" {
+		t, err := parseTimeParam(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid created_after: %s", v)
+		}
+		opts.CreatedAfter = t
+	}
+	if v := c.Query("created_before"); v != "" {
+		t, err := parseTimeParam(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid created_before: %s", v)
+		}
+		opts.CreatedBefore = t
+	}
+
+	// expiring_soon is shorthand for files expiring within the next 24 hours
+	if c.QueryBool("expiring_soon") {
+		opts.ExpiringWithin = 24 * time.Hour
+	}
+	if v := c.Query("expiring_within"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return opts, fmt.Errorf("invalid expiring_within: %s", v)
+		}
+		opts.ExpiringWithin = d
+	}
+
+	return opts, nil
+}
+
+// listErrorStatus maps listing errors to a client or server error status
+func listErrorStatus(err error) int {
+	if errors.Is(err, services.ErrInvalidListOptions) {
+		return fiber.StatusBadRequest
+	}
+	return fiber.StatusInternalServerError
+}
+
+// fileErrorStatus maps file service errors to an HTTP status
+func fileErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrFileNotFound):
+		return fiber.StatusNotFound
+	case errors.Is(err, services.ErrAccessDenied):
+		return fiber.StatusForbidden
+	case errors.Is(err, services.ErrLinkActive):
+		return fiber.StatusConflict
+	default:
+		return fiber.StatusBadRequest
+	}
+}
+
+// ListUserFilesHandler lists the user's personal files, or a team's files with ?team_id=, a page at a time
 func ListUserFilesHandler(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(string)
 
-	files, err := services.ListFilesWithMetadata(userID)
+	opts, err := parseFileListOptions(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if teamID := c.Query("team_id"); teamID != "" {
+		page, err := services.ListTeamFiles(teamID, userID, opts)
+		if err != nil {
+			return c.Status(teamErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(page)
+	}
+
+	page, err := services.ListFilesWithMetadata(userID, opts)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		return c.Status(listErrorStatus(err)).JSON(fiber.Map{
 			"error": err.Error(),
 		})
 	}
 
-	return c.JSON(files)
+	return c.JSON(page)
 }
 
-// DeleteFileHandler handles both single and batch file deletions
+// DeleteFileHandler moves one or more files to the trash
 func DeleteFileHandler(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(string)
 
@@ -177,13 +380,13 @@ func DeleteFileHandler(c *fiber.Ctx) error {
 	// Single file deletion (from path parameter)
 	fileID := c.Params("id")
 	if fileID != "" {
-		err := services.DeleteFileParallel(fileID, userID)
+		err := services.TrashFile(c.UserContext(), fileID, userID)
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			return c.Status(fileErrorStatus(err)).JSON(fiber.Map{
 				"error": err.Error(),
 			})
 		}
-		return c.JSON(fiber.Map{"message": "File deleted successfully"})
+		return c.JSON(fiber.Map{"message": "File moved to trash"})
 	}
 
 	// Handle body-based requests
@@ -193,13 +396,13 @@ func DeleteFileHandler(c *fiber.Ctx) error {
 
 	// Single file deletion from request body
 	if requestBody.FileID != "" {
-		err := services.DeleteFileParallel(requestBody.FileID, userID)
+		err := services.TrashFile(c.UserContext(), requestBody.FileID, userID)
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			return c.Status(fileErrorStatus(err)).JSON(fiber.Map{
 				"error": err.Error(),
 			})
 		}
-		return c.JSON(fiber.Map{"message": "File deleted successfully"})
+		return c.JSON(fiber.Map{"message": "File moved to trash"})
 	}
 
 	// Batch file deletion
@@ -209,17 +412,18 @@ func DeleteFileHandler(c *fiber.Ctx) error {
 		resultsMutex := sync.RWMutex{}
 
 		// Process deletions in parallel
+		ctx := c.UserContext()
 		wg.Add(len(requestBody.FileIDs))
 		for _, fid := range requestBody.FileIDs {
 			go func(fileID string) {
 				defer wg.Done()
-				err := services.DeleteFileParallel(fileID, userID)
+				err := services.TrashFile(ctx, fileID, userID)
 
 				resultsMutex.Lock()
 				if err != nil {
 					results[fileID] = fmt.Sprintf("Error: %s", err.Error())
 				} else {
-					results[fileID] = "Deleted successfully"
+					results[fileID] = "Moved to trash"
 				}
 				resultsMutex.Unlock()
 			}(fid)
@@ -232,7 +436,7 @@ func DeleteFileHandler(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "No file ID provided"})
 }
 
-// BatchDeleteFilesHandler deletes multiple files in parallel
+// BatchDeleteFilesHandler moves multiple files to the trash
 func BatchDeleteFilesHandler(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(string)
 
@@ -250,11 +454,11 @@ func BatchDeleteFilesHandler(c *fiber.Ctx) error {
 
 	results := make(map[string]string)
 	for _, fileID := range requestBody.FileIDs {
-		err := services.DeleteFileParallel(fileID, userID)
+		err := services.TrashFile(c.UserContext(), fileID, userID)
 		if err != nil {
 			results[fileID] = fmt.Sprintf("Error: %s", err.Error())
 		} else {
-			results[fileID] = "Deleted successfully"
+			results[fileID] = "Moved to trash"
 		}
 	}
 
@@ -263,22 +467,97 @@ func BatchDeleteFilesHandler(c *fiber.Ctx) error {
 	})
 }
 
-// GetFileMetadataHandler gets metadata of a single file
-func GetFileMetadataHandler(c *fiber.Ctx) error {
-	fileID := c.Params("id")
-	userID := c.Locals("user_id").(string) // Extract user ID from JWT
+// UpdateFileMetadataHandler edits the description, tags and custom metadata of a file
+func UpdateFileMetadataHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
 
-	// Convert fileID to MongoDB ObjectID
-	objID, err := primitive.ObjectIDFromHex(fileID)
+	var update services.FileMetadataUpdate
+	if err := c.BodyParser(&update); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	file, err := services.UpdateFileMetadata(c.Params("id"), userID, update)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid file ID",
-		})
+		return c.Status(fileErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(file)
+}
+
+// RenameFileHandler changes the display name of a file
+func RenameFileHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	var requestBody struct {
+		Filename string `json:"filename"`
+	}
+	if err := c.BodyParser(&requestBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	file, err := services.RenameFile(c.Params("id"), userID, requestBody.Filename)
+	if err != nil {
+		return c.Status(fileErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "File renamed successfully", "file": file})
+}
+
+// CopyFileHandler duplicates a file server-side
+func CopyFileHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	var requestBody struct {
+		Filename string `json:"filename,omitempty"`
+	}
+	// The body is optional; without it the copy is named "Copy of <filename>"
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&requestBody); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+	}
+
+	file, err := services.CopyFile(c.UserContext(), c.Params("id"), userID, requestBody.Filename)
+	if err != nil {
+		return c.Status(fileErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "File copied successfully", "file": file})
+}
+
+// TransferFileHandler transfers ownership of a file to another user or into a team
+func TransferFileHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	var requestBody struct {
+		Email  string `json:"email"`
+		TeamID string `json:"team_id"`
+	}
+	if err := c.BodyParser(&requestBody); err != nil || (requestBody.Email == "" && requestBody.TeamID == "") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Recipient email or team_id is required"})
+	}
+
+	if requestBody.TeamID != "" {
+		file, err := services.MoveFileToTeam(c.UserContext(), c.Params("id"), userID, requestBody.TeamID)
+		if err != nil {
+			return c.Status(teamErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"message": "File moved to team successfully", "file": file})
 	}
 
-	// Query MongoDB for file metadata
-	var file models.File
-	err = fileCollection.FindOne(context.TODO(), bson.M{"_id": objID, "owner": userID}).Decode(&file)
+	file, err := services.TransferFile(c.UserContext(), c.Params("id"), userID, requestBody.Email)
+	if err != nil {
+		return c.Status(fileErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "File transferred successfully", "file": file})
+}
+
+// GetFileMetadataHandler gets metadata of a single file the user can view
+func GetFileMetadataHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string) // Extract user ID from JWT
+
+	file, err := services.GetFile(c.Params("id"), userID)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "File not found or access denied",
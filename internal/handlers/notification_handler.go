@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"github.com/arzan03/SecureShare/internal/models"
+	"github.com/arzan03/SecureShare/internal/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ListNotificationsHandler returns the caller's inbox; ?unread=true limits it to unread entries
+func ListNotificationsHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	notifications, err := services.ListNotifications(userID, c.QueryBool("unread"), c.QueryInt("limit"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"notifications": notifications})
+}
+
+// MarkNotificationsReadHandler marks the listed notifications, or all of them, as read
+func MarkNotificationsReadHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	var body struct {
+		IDs []string `json:"ids"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+	}
+
+	updated, err := services.MarkNotificationsRead(userID, body.IDs)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"updated": updated})
+}
+
+// GetNotificationPreferencesHandler returns the caller's notification preferences
+func GetNotificationPreferencesHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	prefs, err := services.GetNotificationPreferences(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(prefs)
+}
+
+// UpdateNotificationPreferencesHandler replaces the caller's notification preferences
+func UpdateNotificationPreferencesHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	var prefs models.NotificationPreferences
+	if err := c.BodyParser(&prefs); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	saved, err := services.UpdateNotificationPreferences(userID, prefs)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":     "Notification preferences updated",
+		"preferences": saved,
+	})
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"github.com/arzan03/SecureShare/internal/services"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// SearchFilesHandler searches the caller's personal files, or a team's files with ?team_id=
+func SearchFilesHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	if teamID := c.Query("team_id"); teamID != "" {
+		results, err := services.SearchTeamFiles(teamID, userID, c.Query("q"), int64(c.QueryInt("limit", services.DefaultPageSize)))
+		if err != nil {
+			return c.Status(teamErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"results": results})
+	}
+
+	base := bson.M{"owner": userID, "team_id": bson.M{"$exists": false}, "deleted_at": bson.M{"$exists": false}}
+	results, err := services.SearchFiles(base, c.Query("q"), int64(c.QueryInt("limit", services.DefaultPageSize)))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"results": results})
+}
+
+// AdminSearchFilesHandler searches across every user's files; ?trashed=true searches the trashed ones
+func AdminSearchFilesHandler(c *fiber.Ctx) error {
+	base := bson.M{"deleted_at": bson.M{"$exists": c.QueryBool("trashed")}}
+	results, err := services.SearchFiles(base, c.Query("q"), int64(c.QueryInt("limit", services.DefaultPageSize)))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"results": results})
+}
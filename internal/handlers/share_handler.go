@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"github.com/arzan03/SecureShare/internal/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ShareFileHandler grants another user access to a file
+func ShareFileHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	var requestBody struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+	if err := c.BodyParser(&requestBody); err != nil || requestBody.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Recipient email is required"})
+	}
+	if requestBody.Role == "" {
+		requestBody.Role = services.ShareRoleViewer
+	}
+
+	share, err := services.ShareFile(c.UserContext(), c.Params("id"), userID, requestBody.Email, requestBody.Role)
+	if err != nil {
+		return c.Status(fileErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "File shared successfully", "share": share})
+}
+
+// ListSharesHandler lists the users a file is shared with
+func ListSharesHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	shares, err := services.ListShares(c.Params("id"), userID)
+	if err != nil {
+		return c.Status(fileErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"shares": shares})
+}
+
+// RevokeShareHandler removes a user's access to a file
+func RevokeShareHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	if err := services.RevokeShare(c.UserContext(), c.Params("id"), userID, c.Params("user_id")); err != nil {
+		return c.Status(fileErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "Access revoked"})
+}
+
+// SharedWithMeHandler lists files other users have shared with the caller
+func SharedWithMeHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	opts, err := parseFileListOptions(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	page, err := services.ListSharedWithMe(userID, opts)
+	if err != nil {
+		return c.Status(listErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(page)
+}
+
+// DirectDownloadHandler returns a download link for owners and users the file is shared with
+func DirectDownloadHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	downloadURL, err := services.GetDownloadURL(c.UserContext(), c.Params("id"), userID)
+	if err != nil {
+		return c.Status(fileErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"download_url": downloadURL,
+		"expires_in":   "10 minutes",
+	})
+}
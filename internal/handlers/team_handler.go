@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/arzan03/SecureShare/internal/models"
+	"github.com/arzan03/SecureShare/internal/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+// teamErrorStatus maps team service errors to an HTTP status
+func teamErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrTeamNotFound):
+		return fiber.StatusNotFound
+	case errors.Is(err, services.ErrTeamQuotaExceeded):
+		return fiber.StatusRequestEntityTooLarge
+	case errors.Is(err, services.ErrTeamChanged):
+		return fiber.StatusConflict
+	default:
+		return fileErrorStatus(err)
+	}
+}
+
+// CreateTeamHandler creates a team owned by the caller
+func CreateTeamHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	var requestBody struct {
+		Name string `json:"name"`
+	}
+	if err := c.BodyParser(&requestBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	team, err := services.CreateTeam(requestBody.Name, userID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "Team created successfully", "team": team})
+}
+
+// ListTeamsHandler lists the teams the caller belongs to
+func ListTeamsHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	teams, err := services.ListUserTeams(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"teams": teams})
+}
+
+// GetTeamHandler returns a team with its storage usage
+func GetTeamHandler(c *fiber.Ctx) error {
+	team := c.Locals("team").(models.Team)
+
+	usage, err := services.GetTeamUsage(team)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(usage)
+}
+
+// RenameTeamHandler changes a team's name
+func RenameTeamHandler(c *fiber.Ctx) error {
+	team := c.Locals("team").(models.Team)
+
+	var requestBody struct {
+		Name string `json:"name"`
+	}
+	if err := c.BodyParser(&requestBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := services.RenameTeam(team.ID.Hex(), requestBody.Name); err != nil {
+		return c.Status(teamErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "Team renamed successfully"})
+}
+
+// DeleteTeamHandler deletes a team that no longer owns files
+func DeleteTeamHandler(c *fiber.Ctx) error {
+	team := c.Locals("team").(models.Team)
+
+	if err := services.DeleteTeam(team.ID.Hex()); err != nil {
+		return c.Status(teamErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "Team deleted successfully"})
+}
+
+// AddTeamMemberHandler adds a user to a team
+func AddTeamMemberHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+	team := c.Locals("team").(models.Team)
+
+	var requestBody struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+	if err := c.BodyParser(&requestBody); err != nil || requestBody.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Member email is required"})
+	}
+	if requestBody.Role == "" {
+		requestBody.Role = services.TeamRoleMember
+	}
+
+	member, err := services.AddTeamMember(team, userID, requestBody.Email, requestBody.Role)
+	if err != nil {
+		return c.Status(teamErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "Member added successfully", "member": member})
+}
+
+// UpdateTeamMemberHandler changes a member's role
+func UpdateTeamMemberHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+	team := c.Locals("team").(models.Team)
+
+	var requestBody struct {
+		Role string `json:"role"`
+	}
+	if err := c.BodyParser(&requestBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	member, err := services.UpdateTeamMember(team, userID, c.Params("user_id"), requestBody.Role)
+	if err != nil {
+		return c.Status(teamErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "Member updated successfully", "member": member})
+}
+
+// RemoveTeamMemberHandler removes a member from a team, or lets a member leave
+func RemoveTeamMemberHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+	team := c.Locals("team").(models.Team)
+
+	if err := services.RemoveTeamMember(team, userID, c.Params("user_id")); err != nil {
+		return c.Status(teamErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "Member removed successfully"})
+}
+
+// ListTeamFilesHandler lists a team's files a page at a time
+func ListTeamFilesHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	opts, err := parseFileListOptions(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	page, err := services.ListTeamFiles(c.Params("id"), userID, opts)
+	if err != nil {
+		return c.Status(listErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(page)
+}
+
+// SetTeamQuotaHandler sets a team's storage quota (Admin Only)
+func SetTeamQuotaHandler(c *fiber.Ctx) error {
+	var requestBody struct {
+		QuotaBytes int64 `json:"quota_bytes"`
+	}
+	if err := c.BodyParser(&requestBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := services.SetTeamQuota(c.Params("id"), requestBody.QuotaBytes); err != nil {
+		return c.Status(teamErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "Team quota updated", "quota_bytes": requestBody.QuotaBytes})
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"github.com/arzan03/SecureShare/internal/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ListTrashHandler lists the user's trashed files, or a team's with ?team_id=
+func ListTrashHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	files, err := services.ListTrash(userID, c.Query("team_id"))
+	if err != nil {
+		return c.Status(teamErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"files":          files,
+		"retention_days": int(services.TrashRetention().Hours() / 24),
+	})
+}
+
+// RestoreFileHandler restores a file from the trash
+func RestoreFileHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	if err := services.RestoreFile(c.Params("id"), userID); err != nil {
+		return c.Status(fileErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "File restored successfully"})
+}
+
+// PurgeFileHandler permanently deletes a single file from the trash
+func PurgeFileHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	if err := services.PurgeFile(c.UserContext(), c.Params("id"), userID); err != nil {
+		return c.Status(fileErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "File permanently deleted"})
+}
+
+// EmptyTrashHandler permanently deletes everything in the user's trash, or a team's with ?team_id=
+func EmptyTrashHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	purged, err := services.EmptyTrash(c.UserContext(), userID, c.Query("team_id"))
+	if err != nil {
+		return c.Status(teamErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Trash emptied",
+		"purged":  purged,
+	})
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/arzan03/SecureShare/internal/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+// CreateUploadRequestHandler creates an upload-only link for external contributors
+func CreateUploadRequestHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	var input services.UploadRequestInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	request, err := services.CreateUploadRequest(userID, input)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":        "Upload request created successfully",
+		"upload_request": request,
+		"upload_path":    "/upload/" + request.Token,
+	})
+}
+
+// ListUploadRequestsHandler lists the caller's upload request links
+func ListUploadRequestsHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	requests, err := services.ListUploadRequests(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"upload_requests": requests})
+}
+
+// ListUploadRequestFilesHandler lists the files received through an upload request link
+func ListUploadRequestFilesHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	opts, err := parseFileListOptions(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	page, err := services.ListUploadRequestFiles(c.Params("id"), userID, opts)
+	if err != nil {
+		return c.Status(listErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(page)
+}
+
+// RevokeUploadRequestHandler stops an upload request link from accepting files
+func RevokeUploadRequestHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	if err := services.RevokeUploadRequest(c.Params("id"), userID); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "Upload request revoked"})
+}
+
+// GetUploadRequestHandler describes an upload request link to an unauthenticated contributor
+func GetUploadRequestHandler(c *fiber.Ctx) error {
+	request, err := services.GetUploadRequest(c.Params("token"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Only expose what a contributor needs, not the owner or the token
+	return c.JSON(fiber.Map{
+		"title":           request.Title,
+		"message":         request.Message,
+		"expires_at":      request.ExpiresAt,
+		"files_remaining": request.MaxFiles - request.FilesReceived,
+		"max_file_size":   request.MaxFileSize,
+		"allowed_types":   request.AllowedTypes,
+	})
+}
+
+// UploadViaRequestHandler accepts a file from an unauthenticated contributor
+func UploadViaRequestHandler(c *fiber.Ctx) error {
+	file, err := services.UploadViaRequest(c, c.Params("token"))
+	if errors.Is(err, services.ErrUploadRequestUnavailable) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":  "File uploaded successfully",
+		"filename": file.Filename,
+		"size":     file.Size,
+	})
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/arzan03/SecureShare/internal/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+// webhookErrorStatus maps webhook service errors to HTTP status codes
+func webhookErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrWebhookNotFound), errors.Is(err, services.ErrDeliveryNotFound):
+		return fiber.StatusNotFound
+	default:
+		return fiber.StatusBadRequest
+	}
+}
+
+// createWebhook registers a webhook for the caller; global hooks receive every user's events
+func createWebhook(c *fiber.Ctx, global bool) error {
+	userID := c.Locals("user_id").(string)
+
+	var input services.WebhookInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	webhook, secret, err := services.CreateWebhook(userID, global, input)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// The secret is only ever shown here
+	return c.JSON(fiber.Map{
+		"message": "Webhook created successfully",
+		"webhook": webhook,
+		"secret":  secret,
+	})
+}
+
+// CreateWebhookHandler registers a webhook for the caller's own events
+func CreateWebhookHandler(c *fiber.Ctx) error {
+	return createWebhook(c, false)
+}
+
+// CreateGlobalWebhookHandler registers an admin webhook for every user's events
+func CreateGlobalWebhookHandler(c *fiber.Ctx) error {
+	return createWebhook(c, true)
+}
+
+// ListWebhooksHandler lists the caller's webhooks
+func ListWebhooksHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	webhooks, err := services.ListWebhooks(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"webhooks": webhooks})
+}
+
+// ListGlobalWebhooksHandler lists every admin webhook
+func ListGlobalWebhooksHandler(c *fiber.Ctx) error {
+	webhooks, err := services.ListGlobalWebhooks()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"webhooks": webhooks})
+}
+
+// DeleteWebhookHandler removes one of the caller's webhooks
+func DeleteWebhookHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	if err := services.DeleteWebhook(c.Params("id"), userID); err != nil {
+		return c.Status(webhookErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"message": "Webhook deleted"})
+}
+
+// ListWebhookDeliveriesHandler returns a webhook's delivery log
+func ListWebhookDeliveriesHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	deliveries, err := services.ListWebhookDeliveries(c.Params("id"), userID, c.QueryInt("limit"))
+	if err != nil {
+		return c.Status(webhookErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"deliveries": deliveries})
+}
+
+// RedeliverWebhookHandler sends a past delivery again
+func RedeliverWebhookHandler(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(string)
+
+	delivery, err := services.RedeliverWebhook(c.Params("id"), c.Params("delivery_id"), userID)
+	if err != nil {
+		return c.Status(webhookErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"delivery": delivery})
+}
@@ -0,0 +1,49 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+
+	"github.com/arzan03/SecureShare/internal/config"
+)
+
+// settings is the SMTP configuration; without a host, mail is dropped
+var settings config.Mail
+
+// Configure sets the SMTP server used by Send
+func Configure(cfg config.Mail) {
+	settings = cfg
+}
+
+// Send delivers a plain text email through the configured SMTP server. When
+// no host is configured the message is dropped, which keeps development and
+// test setups working without a mail server. Only the recipient and subject
+// are logged then, since bodies can carry secrets such as reset tokens.
+func Send(to, subject, body string) error {
+	host := settings.Host
+	if host == "" {
+		log.Printf("📧 (mail not configured) dropped mail to=%s subject=%q", to, subject)
+		return nil
+	}
+	from := settings.From
+
+	var auth smtp.Auth
+	if settings.Username != "" {
+		auth = smtp.PlainAuth("", settings.Username, settings.Password, host)
+	}
+
+	// Header values must not contain line breaks or they could inject extra headers
+	subject = strings.NewReplacer("\r", " ", "\n", " ").Replace(subject)
+
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s",
+		from, to, subject, body)
+
+	if err := smtp.SendMail(net.JoinHostPort(host, strconv.Itoa(settings.Port)), auth, from, []string{to}, []byte(msg)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
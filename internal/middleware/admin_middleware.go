@@ -1,6 +1,9 @@
 package middleware
 
 import (
+	"strings"
+
+	"github.com/arzan03/SecureShare/internal/services"
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -15,6 +18,8 @@ func AdminMiddleware(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Missing token"})
 	}
 
+	tokenString = strings.TrimPrefix(tokenString, "Bearer ")
+
 	// Parse token
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		return getJWTSecret(), nil
@@ -36,6 +41,21 @@ func AdminMiddleware(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Access denied. Admins only."})
 	}
 
+	// Impersonation tokens act as a user and never carry admin rights
+	if _, impersonated := claims["impersonator"]; impersonated {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Impersonation tokens cannot access admin routes"})
+	}
+
+	// Reject suspended admins and tokens revoked since they were issued
+	userID, _ := claims["user_id"].(string)
+	if err := services.CheckSession(userID, issuedAt(claims)); err != nil {
+		return sessionError(c, err)
+	}
+
+	// Store admin info in context for the handlers and the audit log
+	c.Locals("user_id", userID)
+	c.Locals("role", role)
+
 	// If everything is fine, continue processing request
 	return c.Next()
 }
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"strconv"
+
+	"github.com/arzan03/SecureShare/internal/audit"
+	"github.com/arzan03/SecureShare/internal/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// AuditMiddleware records every request that reaches it in the audit log, with
+// the outcome status. Must run after AdminMiddleware or AuthMiddleware.
+func AuditMiddleware(c *fiber.Ctx) error {
+	return recordRequest(c, "admin.request")
+}
+
+// recordRequest runs the rest of the chain and records the request under action
+func recordRequest(c *fiber.Ctx, action string) error {
+	err := c.Next()
+
+	status := c.Response().StatusCode()
+	if err != nil {
+		status = fiber.StatusInternalServerError
+		if e, ok := err.(*fiber.Error); ok {
+			status = e.Code
+		}
+	}
+
+	actorID, _ := c.Locals("user_id").(string)
+	impersonator, _ := c.Locals("impersonator").(string)
+	entry := models.AuditEntry{
+		Action:       action,
+		ActorID:      actorID,
+		Impersonator: impersonator,
+		IP:           ClientIP(c),
+		Details: map[string]string{
+			"method": c.Method(),
+			"path":   c.Path(),
+			"status": strconv.Itoa(status),
+		},
+	}
+	if query := string(c.Request().URI().QueryString()); query != "" {
+		entry.Details["query"] = query
+	}
+	if recErr := audit.Record(context.TODO(), entry); recErr != nil {
+		log.Printf("Audit of %s %s failed: %v", c.Method(), c.Path(), recErr)
+	}
+
+	return err
+}
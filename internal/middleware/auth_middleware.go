@@ -1,21 +1,27 @@
 package middleware
 
 import (
-	"os"
+	"errors"
 	"strings"
+	"time"
 
+	"github.com/arzan03/SecureShare/internal/config"
+	"github.com/arzan03/SecureShare/internal/events"
+	"github.com/arzan03/SecureShare/internal/services"
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// Use env variable for JWT secret
+// jwtSecret verifies tokens; set by Configure
+var jwtSecret []byte
+
+// Configure sets the secret tokens are verified with
+func Configure(cfg config.Auth) {
+	jwtSecret = []byte(cfg.JWTSecret)
+}
+
 func getJWTSecret() []byte {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		// Fallback for tests/development
-		return []byte("supersecret")
-	}
-	return []byte(secret)
+	return jwtSecret
 }
 
 // AuthMiddleware validates JWT token and extracts user details
@@ -54,9 +60,48 @@ func AuthMiddleware(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token payload"})
 	}
 
-	// Store user info in context for next handlers
+	// Reject suspended accounts and tokens revoked since they were issued
+	if err := services.CheckSession(userID, issuedAt(claims)); err != nil {
+		return sessionError(c, err)
+	}
+
+	// Store user info in context for next handlers. user_id is the effective
+	// identity; real_user_id is who holds the token, which differs under impersonation.
 	c.Locals("user_id", userID)
+	c.Locals("real_user_id", userID)
 	c.Locals("role", role)
 
+	// Impersonation tokens must still be valid for the admin who was issued them
+	if impersonator, _ := claims["impersonator"].(string); impersonator != "" {
+		if err := services.CheckSession(impersonator, issuedAt(claims)); err != nil {
+			return sessionError(c, err)
+		}
+		c.Locals("real_user_id", impersonator)
+		c.Locals("impersonator", impersonator)
+		c.SetUserContext(events.WithImpersonator(c.UserContext(), impersonator)) // Recorded on the events the request publishes
+		c.Set("X-Impersonated-By", impersonator)
+		return recordRequest(c, "impersonation.request")
+	}
+
 	return c.Next()
 }
+
+// issuedAt returns a token's issue time, zero for tokens without one
+func issuedAt(claims jwt.MapClaims) time.Time {
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		return iat.Time
+	}
+	return time.Time{}
+}
+
+// sessionError responds to a token whose account may no longer use the API
+func sessionError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrAccountSuspended):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Account suspended"})
+	case errors.Is(err, services.ErrSessionRevoked):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Session revoked, please log in again"})
+	default:
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
+}
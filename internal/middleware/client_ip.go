@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net/netip"
+	"strings"
+
+	"github.com/arzan03/SecureShare/internal/config"
+	"github.com/gofiber/fiber/v2"
+)
+
+// trustedProxies are the networks whose X-Forwarded-For entries are believed;
+// set by ConfigureProxies
+var trustedProxies []netip.Prefix
+
+// ConfigureProxies sets the proxies allowed to report the client address
+func ConfigureProxies(cfg config.Server) {
+	trustedProxies = nil
+	for _, proxy := range cfg.TrustedProxies {
+		if prefix, err := netip.ParsePrefix(proxy); err == nil {
+			trustedProxies = append(trustedProxies, prefix.Masked())
+		} else if addr, err := netip.ParseAddr(proxy); err == nil {
+			addr = addr.Unmap()
+			trustedProxies = append(trustedProxies, netip.PrefixFrom(addr, addr.BitLen()))
+		}
+	}
+}
+
+func isTrustedProxy(addr netip.Addr) bool {
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client behind any trusted proxies.
+// X-Forwarded-For is walked from the right: each trusted proxy appends the
+// address it received from, so the first untrusted entry is the client, and
+// anything further left was sent by the client itself and may be forged.
+func ClientIP(c *fiber.Ctx) string {
+	client, ok := netip.AddrFromSlice(c.Context().RemoteIP())
+	if !ok {
+		return c.Context().RemoteIP().String()
+	}
+	client = client.Unmap()
+
+	var hops []string
+	for _, header := range c.Request().Header.PeekAll(fiber.HeaderXForwardedFor) {
+		hops = append(hops, strings.Split(string(header), ",")...)
+	}
+	for i := len(hops) - 1; i >= 0 && isTrustedProxy(client); i-- {
+		addr, err := parseHop(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break // The last trusted proxy is the best address known
+		}
+		client = addr
+	}
+	return client.String()
+}
+
+// parseHop reads an X-Forwarded-For entry, which some proxies write with a port
+func parseHop(hop string) (netip.Addr, error) {
+	addr, err := netip.ParseAddr(hop)
+	if err != nil {
+		addrPort, portErr := netip.ParseAddrPort(hop)
+		if portErr != nil {
+			return netip.Addr{}, err
+		}
+		addr = addrPort.Addr()
+	}
+	return addr.Unmap(), nil
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"errors"
+
+	"github.com/arzan03/SecureShare/internal/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+// TeamMiddleware ensures the user belongs to the team in the :id route parameter with at
+// least minRole, and stores the team in the context for the handlers. Must run after AuthMiddleware.
+func TeamMiddleware(minRole string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, ok := c.Locals("user_id").(string)
+		if !ok || userID == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid user"})
+		}
+
+		team, err := services.RequireTeamRole(c.Params("id"), userID, minRole)
+		if errors.Is(err, services.ErrAccessDenied) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Access denied. Requires team role " + minRole + "."})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Team not found"})
+		}
+
+		c.Locals("team", team)
+		return c.Next()
+	}
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AccessLog records one attempt to redeem a share link, successful or not
+type AccessLog struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	FileID    string             `bson:"file_id" json:"file_id"`
+	LinkID    string             `bson:"link_id,omitempty" json:"link_id,omitempty"` // Empty when the token matched no link
+	Owner     string             `bson:"owner" json:"owner"`
+	UserID    string             `bson:"user_id,omitempty" json:"user_id,omitempty"` // Authenticated caller, if any
+	IP        string             `bson:"ip" json:"ip"`
+	Referer   string             `bson:"referer,omitempty" json:"referer,omitempty"`
+	UserAgent string             `bson:"user_agent,omitempty" json:"user_agent,omitempty"`
+	Success   bool               `bson:"success" json:"success"`
+	Reason    string             `bson:"reason,omitempty" json:"reason,omitempty"` // Why the attempt was refused
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
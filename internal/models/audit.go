@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuditEntry is one link in the tamper-evident audit chain
+type AuditEntry struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Seq          int64              `bson:"seq" json:"seq"`
+	Time         time.Time          `bson:"time" json:"time"`
+	Action       string             `bson:"action" json:"action"`
+	ActorID      string             `bson:"actor_id,omitempty" json:"actor_id,omitempty"` // Empty for system actions
+	ActorEmail   string             `bson:"actor_email,omitempty" json:"actor_email,omitempty"`
+	Impersonator string             `bson:"impersonator,omitempty" json:"impersonator,omitempty"` // Admin acting as ActorID
+	TargetType   string             `bson:"target_type,omitempty" json:"target_type,omitempty"`   // "file", "user", "team", ...
+	TargetID     string             `bson:"target_id,omitempty" json:"target_id,omitempty"`
+	IP           string             `bson:"ip,omitempty" json:"ip,omitempty"`
+	Details      map[string]string  `bson:"details,omitempty" json:"details,omitempty"`
+	PrevHash     string             `bson:"prev_hash" json:"prev_hash"`
+	Hash         string             `bson:"hash" json:"hash"`
+}
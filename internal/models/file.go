@@ -7,14 +7,38 @@ import (
 )
 
 type File struct {
-	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Filename      string             `bson:"filename" json:"filename"`
-	URL           string             `bson:"url" json:"url"`
-	Owner         string             `bson:"owner" json:"owner"`
-	ExpiresAt     time.Time          `bson:"expires_at" json:"expires_at"`
-	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
-	DownloadToken string             `bson:"download_token,omitempty" json:"-"`
-	TokenType     string             `bson:"token_type,omitempty" json:"token_type"` // "one-time" or "time-limited"
-	TokenExpires  time.Time          `bson:"token_expires,omitempty" json:"token_expires"`
+	ID                    primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Filename              string             `bson:"filename" json:"filename"`
+	ObjectKey             string             `bson:"object_key,omitempty" json:"-"` // MinIO object name, independent of Filename
+	Size                  int64              `bson:"size" json:"size"`
+	ContentType           string             `bson:"content_type,omitempty" json:"content_type,omitempty"`
+	Description           string             `bson:"description,omitempty" json:"description,omitempty"`
+	Tags                  []string           `bson:"tags,omitempty" json:"tags,omitempty"`
+	Metadata              map[string]string  `bson:"metadata,omitempty" json:"metadata,omitempty"` // User-defined key-value pairs
+	URL                   string             `bson:"url" json:"url"`
+	Owner                 string             `bson:"owner" json:"owner"`                         // Uploader, or sole owner of personal files
+	TeamID                string             `bson:"team_id,omitempty" json:"team_id,omitempty"` // Set when the file belongs to a team
+	ExpiresAt             time.Time          `bson:"expires_at" json:"expires_at"`
+	CreatedAt             time.Time          `bson:"created_at" json:"created_at"`
+	ExpiryEventSent       bool               `bson:"expiry_event_sent,omitempty" json:"-"`       // file.expired already emitted
+	LinkExpiryNotified    string             `bson:"link_expiry_notified,omitempty" json:"-"`    // Link ID whose expiry warning was already sent
+	LinkID                string             `bson:"link_id,omitempty" json:"link_id,omitempty"` // Identifies the current share link in the access log
+	DownloadToken         string             `bson:"download_token,omitempty" json:"-"`
+	TokenType             string             `bson:"token_type,omitempty" json:"token_type"` // "one-time" or "time-limited"
+	TokenExpires          time.Time          `bson:"token_expires,omitempty" json:"token_expires"`
+	TokenNotBefore        time.Time          `bson:"token_not_before,omitempty" json:"token_not_before,omitempty"`               // Embargo: the link cannot be redeemed earlier
+	TokenAllowedCIDRs     []string           `bson:"token_allowed_cidrs,omitempty" json:"token_allowed_cidrs,omitempty"`         // Networks the link may be redeemed from
+	TokenDeniedCIDRs      []string           `bson:"token_denied_cidrs,omitempty" json:"token_denied_cidrs,omitempty"`           // Networks the link may never be redeemed from
+	TokenAllowedReferrers []string           `bson:"token_allowed_referrers,omitempty" json:"token_allowed_referrers,omitempty"` // Referring hosts, "*.example.com" allowed
+	UploadRequestID       string             `bson:"upload_request_id,omitempty" json:"upload_request_id,omitempty"`             // Upload link the file arrived through
+	Shares                []FileShare        `bson:"shares,omitempty" json:"shares,omitempty"`                                   // Users granted access besides the owner
+	DeletedAt             *time.Time         `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`                           // Set while the file sits in the trash
 }
 
+// FileShare grants another user access to a file
+type FileShare struct {
+	UserID    string    `bson:"user_id" json:"user_id"`
+	Email     string    `bson:"email" json:"email"`
+	Role      string    `bson:"role" json:"role"` // "viewer" or "editor"
+	GrantedAt time.Time `bson:"granted_at" json:"granted_at"`
+}
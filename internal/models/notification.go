@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Notification types
+const (
+	NotificationFileDownloaded = "file.downloaded"
+	NotificationLinkConsumed   = "link.consumed"
+	NotificationLinkExpiring   = "link.expiring"
+)
+
+// NotificationPreferences controls which events a user hears about and how
+type NotificationPreferences struct {
+	UserID            string    `bson:"user_id" json:"-"`
+	OnDownload        bool      `bson:"on_download" json:"on_download"`
+	OnOneTimeConsumed bool      `bson:"on_one_time_consumed" json:"on_one_time_consumed"`
+	OnLinkExpiring    bool      `bson:"on_link_expiring" json:"on_link_expiring"`
+	Email             bool      `bson:"email" json:"email"`
+	InApp             bool      `bson:"in_app" json:"in_app"`
+	WebhookURL        string    `bson:"webhook_url,omitempty" json:"webhook_url,omitempty"`
+	UpdatedAt         time.Time `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
+}
+
+// Notification is an entry in a user's in-app inbox
+type Notification struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    string             `bson:"user_id" json:"-"`
+	Type      string             `bson:"type" json:"type"`
+	FileID    string             `bson:"file_id,omitempty" json:"file_id,omitempty"`
+	LinkID    string             `bson:"link_id,omitempty" json:"link_id,omitempty"`
+	Title     string             `bson:"title" json:"title"`
+	Message   string             `bson:"message" json:"message"`
+	Read      bool               `bson:"read" json:"read"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Team is a shared workspace whose files belong to the team rather than a single user
+type Team struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name       string             `bson:"name" json:"name"`
+	Members    []TeamMember       `bson:"members" json:"members"`
+	QuotaBytes int64              `bson:"quota_bytes" json:"quota_bytes"` // 0 means unlimited
+	CreatedBy  string             `bson:"created_by" json:"created_by"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// TeamMember is a user's membership of a team
+type TeamMember struct {
+	UserID   string    `bson:"user_id" json:"user_id"`
+	Email    string    `bson:"email" json:"email"`
+	Role     string    `bson:"role" json:"role"` // "owner", "admin", "member" or "viewer"
+	JoinedAt time.Time `bson:"joined_at" json:"joined_at"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UploadRequest is a link that lets people without an account upload files into the owner's space
+type UploadRequest struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Owner         string             `bson:"owner" json:"owner"`
+	Token         string             `bson:"token" json:"token"`
+	Title         string             `bson:"title" json:"title"`
+	Message       string             `bson:"message,omitempty" json:"message,omitempty"`
+	ExpiresAt     time.Time          `bson:"expires_at" json:"expires_at"`
+	MaxFiles      int                `bson:"max_files" json:"max_files"`
+	MaxFileSize   int64              `bson:"max_file_size" json:"max_file_size"`                     // Bytes per file
+	AllowedTypes  []string           `bson:"allowed_types,omitempty" json:"allowed_types,omitempty"` // Content types ("image/*" allowed) or extensions (".pdf")
+	FilesReceived int                `bson:"files_received" json:"files_received"`
+	Revoked       bool               `bson:"revoked" json:"revoked"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+}
@@ -7,9 +7,19 @@ import (
 )
 
 type User struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	Email     string             `bson:"email" json:"email" validate:"required,email"`
-	Password  string             `bson:"password,omitempty" json:"-"`
-	Role      string             `bson:"role" json:"role"`
-	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Email       string             `bson:"email" json:"email" validate:"required,email"`
+	Password    string             `bson:"password,omitempty" json:"-"`
+	Role        string             `bson:"role" json:"role"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	LastLoginAt *time.Time         `bson:"last_login_at,omitempty" json:"last_login_at,omitempty"`
+
+	// Account state managed by admins
+	Suspended              bool       `bson:"suspended,omitempty" json:"suspended"`
+	SuspendedAt            *time.Time `bson:"suspended_at,omitempty" json:"suspended_at,omitempty"`
+	SuspendReason          string     `bson:"suspend_reason,omitempty" json:"suspend_reason,omitempty"`
+	PasswordResetRequired  bool       `bson:"password_reset_required,omitempty" json:"password_reset_required"`
+	PasswordResetTokenHash string     `bson:"password_reset_token_hash,omitempty" json:"-"`
+	PasswordResetExpires   *time.Time `bson:"password_reset_expires,omitempty" json:"-"`
+	SessionsRevokedAt      *time.Time `bson:"sessions_revoked_at,omitempty" json:"-"` // Tokens issued before this are rejected
 }
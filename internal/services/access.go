@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/arzan03/SecureShare/internal/db"
+	"github.com/arzan03/SecureShare/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrFileNotFound = errors.New("file not found")
+	ErrAccessDenied = errors.New("access denied")
+)
+
+// FileAccess is the level of access a user holds on a file, in increasing order
+type FileAccess int
+
+const (
+	AccessNone  FileAccess = iota
+	AccessView             // Read metadata and download
+	AccessEdit             // Also rename, tag, copy and create share links
+	AccessOwner            // Also delete, transfer and manage grants
+)
+
+// Share roles that can be granted to other users
+const (
+	ShareRoleViewer = "viewer"
+	ShareRoleEditor = "editor"
+)
+
+// accessLevel works out what a user may do with a file given their role in the
+// file's team ("" for personal files or non-members)
+func accessLevel(file models.File, userID, teamRole string) FileAccess {
+	level := AccessNone
+
+	if file.TeamID == "" {
+		if file.Owner == userID {
+			return AccessOwner
+		}
+	} else {
+		switch teamRole {
+		case TeamRoleOwner, TeamRoleAdmin:
+			return AccessOwner
+		case TeamRoleMember:
+			// Members manage what they uploaded and edit everything else
+			if file.Owner == userID {
+				return AccessOwner
+			}
+			level = AccessEdit
+		case TeamRoleViewer:
+			level = AccessView
+		}
+	}
+
+	for _, share := range file.Shares {
+		if share.UserID != userID {
+			continue
+		}
+		if share.Role == ShareRoleEditor && level < AccessEdit {
+			level = AccessEdit
+		} else if level < AccessView {
+			level = AccessView
+		}
+	}
+	return level
+}
+
+// fileTeamRole returns the user's role in the file's team, "" for personal files
+func fileTeamRole(file models.File, userID string) string {
+	if file.TeamID == "" {
+		return ""
+	}
+	return teamRoleOf(file.TeamID, userID)
+}
+
+// viewFor returns the file as the user may see it. Other users' grants are
+// only shown to those who manage them, and the share link's ID and
+// restrictions only to those who may create links.
+func viewFor(file models.File, userID, teamRole string) models.File {
+	level := accessLevel(file, userID, teamRole)
+	if level < AccessOwner {
+		var own []models.FileShare
+		for _, share := range file.Shares {
+			if share.UserID == userID {
+				own = append(own, share)
+			}
+		}
+		file.Shares = own
+	}
+	if level < AccessEdit {
+		file.LinkID = ""
+		file.TokenAllowedCIDRs = nil
+		file.TokenDeniedCIDRs = nil
+		file.TokenAllowedReferrers = nil
+	}
+	return file
+}
+
+// checkAccess verifies the user holds at least the required access on a loaded file.
+// Users without any access get ErrFileNotFound so the file's existence is not revealed.
+func checkAccess(file models.File, userID string, required FileAccess) error {
+	level := accessLevel(file, userID, fileTeamRole(file, userID))
+	if level == AccessNone {
+		return ErrFileNotFound
+	}
+	if level < required {
+		return ErrAccessDenied
+	}
+	return nil
+}
+
+// loadFile loads a non-trashed file and checks the user holds at least the required access
+func loadFile(fileID, userID string, required FileAccess) (models.File, error) {
+	return findFile(fileID, userID, required, false)
+}
+
+// loadFileAsAdmin loads any non-trashed file without an access check, for admin support actions
+func loadFileAsAdmin(fileID string) (models.File, error) {
+	objID, err := primitive.ObjectIDFromHex(fileID)
+	if err != nil {
+		return models.File{}, ErrFileNotFound
+	}
+
+	collection := db.Collection("files")
+	var file models.File
+	err = collection.FindOne(context.TODO(), bson.M{"_id": objID, "deleted_at": bson.M{"$exists": false}}).Decode(&file)
+	if err != nil {
+		return models.File{}, ErrFileNotFound
+	}
+	return file, nil
+}
+
+// loadTrashedFile loads a trashed file and checks the user holds at least the required access
+func loadTrashedFile(fileID, userID string, required FileAccess) (models.File, error) {
+	return findFile(fileID, userID, required, true)
+}
+
+func findFile(fileID, userID string, required FileAccess, trashed bool) (models.File, error) {
+	objID, err := primitive.ObjectIDFromHex(fileID)
+	if err != nil {
+		return models.File{}, fmt.Errorf("invalid file ID: %w", err)
+	}
+
+	collection := db.Collection("files")
+	var file models.File
+	err = collection.FindOne(context.TODO(), bson.M{"_id": objID, "deleted_at": bson.M{"$exists": trashed}}).Decode(&file)
+	if err != nil {
+		return models.File{}, ErrFileNotFound
+	}
+
+	if err := checkAccess(file, userID, required); err != nil {
+		return models.File{}, err
+	}
+	return file, nil
+}
+
+// GetFile returns a file the user can view, without the details their access does not cover
+func GetFile(fileID, userID string) (models.File, error) {
+	file, err := loadFile(fileID, userID, AccessView)
+	if err != nil {
+		return models.File{}, err
+	}
+	return viewFor(file, userID, fileTeamRole(file, userID)), nil
+}
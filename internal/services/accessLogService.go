@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/arzan03/SecureShare/internal/db"
+	"github.com/arzan03/SecureShare/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultAccessWindow = 30 * 24 * time.Hour
+	defaultRecentAccess = 20
+)
+
+var ErrInvalidAccessQuery = errors.New("invalid access query")
+
+// AccessQuery selects the period and granularity of an access summary
+type AccessQuery struct {
+	Interval string    // "hour", "day" (default) or "week"
+	Since    time.Time // Defaults to 30 days ago
+	Limit    int       // Number of recent accesses to return
+}
+
+// AccessBucket counts redemptions within one interval
+type AccessBucket struct {
+	Period     time.Time `bson:"_id" json:"period"`
+	Successful int64     `bson:"successful" json:"successful"`
+	Failed     int64     `bson:"failed" json:"failed"`
+}
+
+// AccessSummary describes how a file or link has been used
+type AccessSummary struct {
+	Total       int64              `json:"total"`
+	Successful  int64              `json:"successful"`
+	Failed      int64              `json:"failed"`
+	UniqueIPs   int64              `json:"unique_ips"`
+	FirstAccess *time.Time         `json:"first_access,omitempty"`
+	LastAccess  *time.Time         `json:"last_access,omitempty"`
+	Timeline    []AccessBucket     `json:"timeline"`
+	Recent      []models.AccessLog `json:"recent"`
+}
+
+// recordAccess logs a link redemption; an empty reason means it succeeded
+func recordAccess(file models.File, linkID string, client DownloadClient, reason string) {
+	collection := db.Collection("access_logs")
+	_, err := collection.InsertOne(context.TODO(), models.AccessLog{
+		FileID:    file.ID.Hex(),
+		LinkID:    linkID,
+		Owner:     file.Owner,
+		UserID:    client.UserID,
+		IP:        client.IP,
+		Referer:   client.Referer,
+		UserAgent: client.UserAgent,
+		Success:   reason == "",
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		log.Printf("Failed to record access for file %s: %v", file.ID.Hex(), err)
+	}
+}
+
+// GetFileAccessSummary summarizes redemptions of every link a file has had
+func GetFileAccessSummary(fileID, userID string, q AccessQuery) (AccessSummary, error) {
+	if _, err := loadFile(fileID, userID, AccessEdit); err != nil {
+		return AccessSummary{}, err
+	}
+	return summarizeAccess(bson.M{"file_id": fileID}, q)
+}
+
+// GetLinkAccessSummary summarizes redemptions of one share link
+func GetLinkAccessSummary(fileID, linkID, userID string, q AccessQuery) (AccessSummary, error) {
+	if _, err := loadFile(fileID, userID, AccessEdit); err != nil {
+		return AccessSummary{}, err
+	}
+	return summarizeAccess(bson.M{"file_id": fileID, "link_id": linkID}, q)
+}
+
+// summarizeAccess totals, buckets and samples the matching access log entries in one aggregation
+func summarizeAccess(filter bson.M, q AccessQuery) (AccessSummary, error) {
+	switch q.Interval {
+	case "":
+		q.Interval = "day"
+	case "hour", "day", "week":
+	default:
+		return AccessSummary{}, fmt.Errorf("%w: interval must be hour, day or week", ErrInvalidAccessQuery)
+	}
+	if q.Since.IsZero() {
+		q.Since = time.Now().Add(-defaultAccessWindow)
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultRecentAccess
+	} else if q.Limit > MaxPageSize {
+		q.Limit = MaxPageSize
+	}
+
+	filter["created_at"] = bson.M{"$gte": q.Since}
+	successCount := bson.M{"$sum": bson.M{"$cond": bson.A{"$success", 1, 0}}}
+	failureCount := bson.M{"$sum": bson.M{"$cond": bson.A{"$success", 0, 1}}}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$facet", Value: bson.M{
+			"totals": bson.A{
+				bson.M{"$group": bson.M{
+					"_id":        nil,
+					"total":      bson.M{"$sum": 1},
+					"successful": successCount,
+					"failed":     failureCount,
+					"ips":        bson.M{"$addToSet": "$ip"},
+					"first":      bson.M{"$min": "$created_at"},
+					"last":       bson.M{"$max": "$created_at"},
+				}},
+				bson.M{"$project": bson.M{
+					"total": 1, "successful": 1, "failed": 1, "first": 1, "last": 1,
+					"unique_ips": bson.M{"$size": "$ips"},
+				}},
+			},
+			"timeline": bson.A{
+				bson.M{"$group": bson.M{
+					"_id":        bson.M{"$dateTrunc": bson.M{"date": "$created_at", "unit": q.Interval}},
+					"successful": successCount,
+					"failed":     failureCount,
+				}},
+				bson.M{"$sort": bson.M{"_id": 1}},
+			},
+			"recent": bson.A{
+				bson.M{"$sort": bson.M{"created_at": -1}},
+				bson.M{"$limit": q.Limit},
+			},
+		}}},
+	}
+
+	collection := db.Collection("access_logs")
+	cursor, err := collection.Aggregate(context.TODO(), pipeline)
+	if err != nil {
+		return AccessSummary{}, fmt.Errorf("failed to summarize access log: %w", err)
+	}
+	defer cursor.Close(context.TODO())
+
+	var facets []struct {
+		Totals []struct {
+			Total      int64     `bson:"total"`
+			Successful int64     `bson:"successful"`
+			Failed     int64     `bson:"failed"`
+			UniqueIPs  int64     `bson:"unique_ips"`
+			First      time.Time `bson:"first"`
+			Last       time.Time `bson:"last"`
+		} `bson:"totals"`
+		Timeline []AccessBucket     `bson:"timeline"`
+		Recent   []models.AccessLog `bson:"recent"`
+	}
+	if err := cursor.All(context.TODO(), &facets); err != nil {
+		return AccessSummary{}, fmt.Errorf("error decoding access summary: %w", err)
+	}
+
+	summary := AccessSummary{Timeline: []AccessBucket{}, Recent: []models.AccessLog{}}
+	if len(facets) == 0 {
+		return summary, nil
+	}
+	if facets[0].Timeline != nil {
+		summary.Timeline = facets[0].Timeline
+	}
+	if facets[0].Recent != nil {
+		summary.Recent = facets[0].Recent
+	}
+	if len(facets[0].Totals) > 0 {
+		totals := facets[0].Totals[0]
+		summary.Total = totals.Total
+		summary.Successful = totals.Successful
+		summary.Failed = totals.Failed
+		summary.UniqueIPs = totals.UniqueIPs
+		summary.FirstAccess = &totals.First
+		summary.LastAccess = &totals.Last
+	}
+	return summary, nil
+}
+
+// ListLinkRejections returns recent refused download attempts for a file, newest first
+func ListLinkRejections(fileID, userID string, limit int) ([]models.AccessLog, error) {
+	if _, err := loadFile(fileID, userID, AccessEdit); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	collection := db.Collection("access_logs")
+	cursor, err := collection.Find(context.TODO(), bson.M{"file_id": fileID, "success": false},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve rejections: %w", err)
+	}
+	defer cursor.Close(context.TODO())
+
+	rejections := []models.AccessLog{}
+	if err = cursor.All(context.TODO(), &rejections); err != nil {
+		return nil, fmt.Errorf("error decoding rejections: %w", err)
+	}
+	return rejections, nil
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/arzan03/SecureShare/internal/db"
+	"github.com/arzan03/SecureShare/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MaxBulkDelete caps how many files one bulk deletion removes; run it again for the rest
+const MaxBulkDelete = 1000
+
+var (
+	// ErrEmptyBulkFilter guards against deleting every file by accident
+	ErrEmptyBulkFilter = errors.New("at least one of owner, older_than_days, created_before, min_size or max_size is required")
+	// ErrInvalidBulkFilter is returned for filter values that cannot select files
+	ErrInvalidBulkFilter = errors.New("invalid bulk delete filter")
+)
+
+// BulkDeleteFilter selects files for an admin bulk deletion; set criteria are combined
+type BulkDeleteFilter struct {
+	Owner         string    `json:"owner"`
+	OlderThanDays int       `json:"older_than_days"` // Created more than this many days ago
+	CreatedBefore time.Time `json:"created_before"`
+	MinSize       int64     `json:"min_size"` // Bytes, inclusive
+	MaxSize       int64     `json:"max_size"` // Bytes, inclusive
+	DryRun        bool      `json:"dry_run"`
+}
+
+// query builds the Mongo filter; trashed files match as well
+func (f BulkDeleteFilter) query() (bson.M, error) {
+	if f.OlderThanDays < 0 || f.MinSize < 0 || f.MaxSize < 0 {
+		return nil, fmt.Errorf("%w: older_than_days, min_size and max_size cannot be negative", ErrInvalidBulkFilter)
+	}
+	if f.MaxSize > 0 && f.MinSize > f.MaxSize {
+		return nil, fmt.Errorf("%w: min_size cannot exceed max_size", ErrInvalidBulkFilter)
+	}
+
+	query := bson.M{}
+	if f.Owner != "" {
+		query["owner"] = f.Owner
+	}
+
+	cutoff := f.CreatedBefore
+	if f.OlderThanDays > 0 {
+		age := time.Now().AddDate(0, 0, -f.OlderThanDays)
+		if cutoff.IsZero() || age.Before(cutoff) {
+			cutoff = age
+		}
+	}
+	if !cutoff.IsZero() {
+		query["created_at"] = bson.M{"$lt": cutoff}
+	}
+
+	size := bson.M{}
+	if f.MinSize > 0 {
+		size["$gte"] = f.MinSize
+	}
+	if f.MaxSize > 0 {
+		size["$lte"] = f.MaxSize
+	}
+	if len(size) > 0 {
+		query["size"] = size
+	}
+
+	if len(query) == 0 {
+		return nil, ErrEmptyBulkFilter
+	}
+	return query, nil
+}
+
+// DeletedFile summarizes a file removed (or, in a dry run, selected) by an admin
+type DeletedFile struct {
+	ID        string    `json:"id"`
+	Filename  string    `json:"filename"`
+	Owner     string    `json:"owner"`
+	TeamID    string    `json:"team_id,omitempty"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+	Trashed   bool      `json:"trashed"`
+}
+
+// BulkDeleteResult reports what a bulk deletion removed, or would remove in a dry run
+type BulkDeleteResult struct {
+	DryRun    bool          `json:"dry_run"`
+	Matched   int64         `json:"matched"` // Every file matching the filter
+	Deleted   int           `json:"deleted"`
+	Failed    int           `json:"failed"`
+	Bytes     int64         `json:"bytes"` // Size of the selected files
+	Truncated bool          `json:"truncated"`
+	Files     []DeletedFile `json:"files"`                // The selected files, at most MaxBulkDelete
+	FailedIDs []string      `json:"failed_ids,omitempty"` // Selected files that could not be removed
+}
+
+func deletedFile(file models.File) DeletedFile {
+	return DeletedFile{
+		ID:        file.ID.Hex(),
+		Filename:  file.Filename,
+		Owner:     file.Owner,
+		TeamID:    file.TeamID,
+		Size:      file.Size,
+		CreatedAt: file.CreatedAt,
+		Trashed:   file.DeletedAt != nil,
+	}
+}
+
+// AdminDeleteFile permanently removes any file, trashed or not, with its stored object.
+// In a dry run the file is only looked up.
+func AdminDeleteFile(adminID, fileID string, dryRun bool) (DeletedFile, error) {
+	objID, err := primitive.ObjectIDFromHex(fileID)
+	if err != nil {
+		return DeletedFile{}, ErrFileNotFound
+	}
+
+	collection := db.Collection("files")
+	var file models.File
+	if err := collection.FindOne(context.TODO(), bson.M{"_id": objID}).Decode(&file); err != nil {
+		return DeletedFile{}, ErrFileNotFound
+	}
+
+	if !dryRun {
+		if err := removeFileParallel(context.TODO(), file, adminID); err != nil {
+			return DeletedFile{}, err
+		}
+	}
+	return deletedFile(file), nil
+}
+
+// AdminBulkDelete permanently removes up to MaxBulkDelete files matching the
+// filter, oldest first, or only reports them when the filter is a dry run
+func AdminBulkDelete(adminID string, f BulkDeleteFilter) (BulkDeleteResult, error) {
+	query, err := f.query()
+	if err != nil {
+		return BulkDeleteResult{}, err
+	}
+
+	collection := db.Collection("files")
+	matched, err := collection.CountDocuments(context.TODO(), query)
+	if err != nil {
+		return BulkDeleteResult{}, fmt.Errorf("failed to count files: %w", err)
+	}
+
+	cursor, err := collection.Find(context.TODO(), query,
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}).SetLimit(MaxBulkDelete))
+	if err != nil {
+		return BulkDeleteResult{}, fmt.Errorf("failed to find files: %w", err)
+	}
+	var files []models.File
+	if err = cursor.All(context.TODO(), &files); err != nil {
+		return BulkDeleteResult{}, fmt.Errorf("error decoding files: %w", err)
+	}
+
+	result := BulkDeleteResult{
+		DryRun:    f.DryRun,
+		Matched:   matched,
+		Truncated: matched > int64(len(files)),
+		Files:     make([]DeletedFile, 0, len(files)),
+	}
+	for _, file := range files {
+		result.Files = append(result.Files, deletedFile(file))
+		result.Bytes += file.Size
+	}
+
+	if !f.DryRun {
+		result.FailedIDs = purgeFiles(context.TODO(), files, adminID)
+		result.Failed = len(result.FailedIDs)
+		result.Deleted = len(files) - result.Failed
+	}
+	return result, nil
+}
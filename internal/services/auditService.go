@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/arzan03/SecureShare/internal/audit"
+	"github.com/arzan03/SecureShare/internal/events"
+	"github.com/arzan03/SecureShare/internal/models"
+)
+
+// auditedEvents are the bus events copied into the audit log
+var auditedEvents = []string{
+	events.TypeUserRegistered,
+	events.TypeUserLoggedIn,
+	events.TypeUserLoginFailed,
+	events.TypeFileUploaded,
+	events.TypeFileDeleted,
+	events.TypeFileShared,
+	events.TypeShareRevoked,
+	events.TypeFileDownloaded,
+	events.TypeFileTransferred,
+	events.TypeLinkCreated,
+	events.TypeLinkRedeemed,
+	events.TypeUserSuspended,
+	events.TypeUserReactivated,
+	events.TypeUserRoleChanged,
+	events.TypePasswordResetForced,
+	events.TypePasswordReset,
+	events.TypeUserDeleted,
+	events.TypeUserImpersonated,
+}
+
+// auditSubscriber appends an audit entry for each audited event
+func auditSubscriber(ctx context.Context, e events.Event) error {
+	entry, ok := auditEntryFor(e.Payload)
+	if !ok {
+		return nil
+	}
+	entry.Action = e.Type
+	entry.Impersonator = e.Impersonator
+	entry.Details["event_id"] = e.ID
+	return audit.Record(ctx, entry)
+}
+
+// auditEntryFor describes who did what to which target for an event payload
+func auditEntryFor(p events.Payload) (models.AuditEntry, bool) {
+	switch p := p.(type) {
+	case events.UserRegistered:
+		return models.AuditEntry{ActorID: p.UserID, ActorEmail: p.Email, TargetType: "user", TargetID: p.UserID, IP: p.IP,
+			Details: map[string]string{}}, true
+	case events.UserLoggedIn:
+		return models.AuditEntry{ActorID: p.UserID, ActorEmail: p.Email, TargetType: "user", TargetID: p.UserID, IP: p.IP,
+			Details: map[string]string{}}, true
+	case events.UserLoginFailed:
+		return models.AuditEntry{ActorEmail: p.Email, TargetType: "user", IP: p.IP,
+			Details: map[string]string{"reason": p.Reason}}, true
+	case events.UserSuspended:
+		return userAuditEntry(p.UserID, p.Email, p.ActorID, map[string]string{"reason": p.Reason}), true
+	case events.UserReactivated:
+		return userAuditEntry(p.UserID, p.Email, p.ActorID, nil), true
+	case events.UserRoleChanged:
+		return userAuditEntry(p.UserID, p.Email, p.ActorID, map[string]string{"old_role": p.OldRole, "new_role": p.NewRole}), true
+	case events.PasswordResetForced:
+		return userAuditEntry(p.UserID, p.Email, p.ActorID, nil), true
+	case events.PasswordReset:
+		return models.AuditEntry{ActorID: p.UserID, ActorEmail: p.Email, TargetType: "user", TargetID: p.UserID, IP: p.IP,
+			Details: map[string]string{}}, true
+	case events.UserDeleted:
+		return userAuditEntry(p.UserID, p.Email, p.ActorID, map[string]string{"files_deleted": strconv.Itoa(p.FilesDeleted)}), true
+	case events.UserImpersonated:
+		return userAuditEntry(p.UserID, p.Email, p.ActorID, map[string]string{"expires_at": p.ExpiresAt.UTC().Format(time.RFC3339)}), true
+	case events.FileUploaded:
+		if p.CopiedFrom != "" {
+			return fileAuditEntry(p.File, p.ActorID, map[string]string{"copied_from": p.CopiedFrom}), true
+		}
+		return fileAuditEntry(p.File, p.File.Owner, nil), true
+	case events.FileDeleted:
+		return fileAuditEntry(p.File, p.ActorID, map[string]string{"permanent": strconv.FormatBool(p.Permanent)}), true
+	case events.FileShared:
+		return fileAuditEntry(p.File, p.ActorID, map[string]string{"user_id": p.Share.UserID, "role": p.Share.Role}), true
+	case events.ShareRevoked:
+		return fileAuditEntry(p.File, p.ActorID, map[string]string{"user_id": p.UserID}), true
+	case events.FileDownloaded:
+		return fileAuditEntry(p.File, p.UserID, adminAccessDetails(p.AdminAccess, nil)), true
+	case events.FileTransferred:
+		details := map[string]string{"previous_owner": p.PreviousOwner}
+		if p.File.TeamID != "" {
+			details["team_id"] = p.File.TeamID
+		}
+		return fileAuditEntry(p.File, p.ActorID, details), true
+	case events.LinkCreated:
+		details := map[string]string{"link_id": p.File.LinkID, "token_type": p.File.TokenType}
+		return fileAuditEntry(p.File, p.ActorID, adminAccessDetails(p.AdminAccess, details)), true
+	case events.LinkRedeemed:
+		entry := fileAuditEntry(p.File, p.UserID, map[string]string{"link_id": p.File.LinkID})
+		entry.IP = p.IP
+		return entry, true
+	}
+	return models.AuditEntry{}, false
+}
+
+// fileAuditEntry builds an entry targeting a file
+func fileAuditEntry(file models.File, actorID string, details map[string]string) models.AuditEntry {
+	if details == nil {
+		details = map[string]string{}
+	}
+	details["filename"] = file.Filename
+	details["owner"] = file.Owner
+	return models.AuditEntry{ActorID: actorID, TargetType: "file", TargetID: file.ID.Hex(), Details: details}
+}
+
+// userAuditEntry builds an entry for an admin acting on a user account
+func userAuditEntry(userID, email, actorID string, details map[string]string) models.AuditEntry {
+	if details == nil {
+		details = map[string]string{}
+	}
+	details["email"] = email
+	return models.AuditEntry{ActorID: actorID, TargetType: "user", TargetID: userID, Details: details}
+}
+
+// adminAccessDetails flags entries for admins acting on files they have no access of their own to
+func adminAccessDetails(adminAccess bool, details map[string]string) map[string]string {
+	if !adminAccess {
+		return details
+	}
+	if details == nil {
+		details = map[string]string{}
+	}
+	details["admin_access"] = "true"
+	return details
+}
@@ -3,10 +3,12 @@ package services
 import (
 	"context"
 	"errors"
-	"os"
+	"log"
 	"time"
 
+	"github.com/arzan03/SecureShare/internal/config"
 	"github.com/arzan03/SecureShare/internal/db"
+	"github.com/arzan03/SecureShare/internal/events"
 	"github.com/arzan03/SecureShare/internal/models"
 	"github.com/golang-jwt/jwt/v5"
 	"go.mongodb.org/mongo-driver/bson"
@@ -14,14 +16,29 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-// Get JWT secret from environment
+// settings is the configuration the services run with, the defaults until Configure is called
+var settings = config.Default()
+
+// Configure sets the configuration used by the services
+func Configure(cfg *config.Config) {
+	settings = cfg
+}
+
+// runBackground starts work that outlives the request that asked for it; the
+// context is cancelled on shutdown. Short cleanups may ignore it so they are not
+// cut off, since shutdown waits for them. Set by SetBackgroundRunner.
+var runBackground = func(run func(ctx context.Context)) {
+	go run(context.Background())
+}
+
+// SetBackgroundRunner starts the services' background work through run, such
+// as the server's worker group, so shutdown can wait for it
+func SetBackgroundRunner(run func(func(ctx context.Context))) {
+	runBackground = run
+}
+
 func getJWTSecret() []byte {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		// Fallback for tests/development
-		return []byte("supersecret")
-	}
-	return []byte(secret)
+	return []byte(settings.Auth.JWTSecret)
 }
 
 // HashPassword hashes a password using bcrypt
@@ -40,7 +57,8 @@ func GenerateJWT(userID string, role string) (string, error) {
 	claims := jwt.MapClaims{
 		"user_id": userID,
 		"role":    role,
-		"exp":     time.Now().Add(time.Hour * 4).Unix(), // Token expires in 4 hours
+		"iat":     time.Now().Unix(),
+		"exp":     time.Now().Add(settings.Auth.TokenTTL).Unix(),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -48,8 +66,8 @@ func GenerateJWT(userID string, role string) (string, error) {
 }
 
 // RegisterUser registers a new user with role validation
-func RegisterUser(email, password, role string) (models.User, error) {
-	collection := db.GetCollection("secure_files", "users")
+func RegisterUser(email, password, role, ip string) (models.User, error) {
+	collection := db.Collection("users")
 
 	// Check if user already exists
 	var existingUser models.User
@@ -69,33 +87,79 @@ func RegisterUser(email, password, role string) (models.User, error) {
 		ID:        primitive.NewObjectID(),
 		Email:     email,
 		Password:  hashedPassword,
-		Role:      "user",
+		Role:      RoleUser,
 		CreatedAt: time.Now(),
 	}
-	_, err = collection.InsertOne(context.TODO(), user)
-	return user, err
+	if _, err = collection.InsertOne(context.TODO(), user); err != nil {
+		return models.User{}, err
+	}
+
+	publish(context.TODO(), events.UserRegistered{UserID: user.ID.Hex(), Email: user.Email, IP: ip})
+	return user, nil
 }
 
-// LoginUser authenticates a user and returns a JWT with role info
-func LoginUser(email, password string) (string, error) {
-	collection := db.GetCollection("secure_files", "users")
+// LoginUser authenticates a user and returns a JWT with role info.
+// ip is the client address, recorded with the login events.
+func LoginUser(email, password, ip string) (string, error) {
+	collection := db.Collection("users")
 
 	var user models.User
 	err := collection.FindOne(context.TODO(), bson.M{"email": email}).Decode(&user)
 	if err != nil {
+		publish(context.TODO(), events.UserLoginFailed{Email: email, Reason: "unknown email", IP: ip})
 		return "", errors.New("invalid credentials")
 	}
 
 	// Verify password
 	if !VerifyPassword(password, user.Password) {
+		publish(context.TODO(), events.UserLoginFailed{Email: email, Reason: "wrong password", IP: ip})
 		return "", errors.New("invalid credentials")
 	}
 
+	// Only reveal the account state to someone who knows the password
+	if user.Suspended {
+		publish(context.TODO(), events.UserLoginFailed{Email: email, Reason: "suspended", IP: ip})
+		return "", ErrAccountSuspended
+	}
+	if user.PasswordResetRequired {
+		publish(context.TODO(), events.UserLoginFailed{Email: email, Reason: "password reset required", IP: ip})
+		return "", ErrPasswordResetRequired
+	}
+
 	// Generate JWT including role
 	token, err := GenerateJWT(user.ID.Hex(), user.Role)
 	if err != nil {
 		return "", err
 	}
 
+	if _, err := collection.UpdateOne(context.TODO(), bson.M{"_id": user.ID},
+		bson.M{"$set": bson.M{"last_login_at": time.Now()}}); err != nil {
+		log.Printf("Failed to record login time for %s: %v", user.ID.Hex(), err)
+	}
+
+	publish(context.TODO(), events.UserLoggedIn{UserID: user.ID.Hex(), Email: user.Email, IP: ip})
 	return token, nil
 }
+
+// FindUserByEmail looks up a user by email address
+func FindUserByEmail(email string) (models.User, error) {
+	collection := db.Collection("users")
+
+	var user models.User
+	err := collection.FindOne(context.TODO(), bson.M{"email": email}).Decode(&user)
+	return user, err
+}
+
+// findUserByID looks up a user by their hex ID
+func findUserByID(userID string) (models.User, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	collection := db.Collection("users")
+
+	var user models.User
+	err = collection.FindOne(context.TODO(), bson.M{"_id": objID}).Decode(&user)
+	return user, err
+}
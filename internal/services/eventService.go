@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/arzan03/SecureShare/internal/db"
+	"github.com/arzan03/SecureShare/internal/events"
+	"github.com/arzan03/SecureShare/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RegisterEventSubscribers attaches the services' side effects to the event bus
+func RegisterEventSubscribers() {
+	for _, eventType := range []string{
+		events.TypeFileUploaded,
+		events.TypeFileDeleted,
+		events.TypeFileExpired,
+		events.TypeLinkCreated,
+		events.TypeLinkRedeemed,
+	} {
+		events.SubscribeAsync(eventType, "webhooks", webhookSubscriber)
+	}
+
+	events.SubscribeAsync(events.TypeLinkRedeemed, "notifications", notificationSubscriber)
+	events.SubscribeAsync(events.TypeFileDownloaded, "notifications", notificationSubscriber)
+
+	for _, eventType := range auditedEvents {
+		events.SubscribeAsync(eventType, "audit", auditSubscriber)
+	}
+}
+
+// publish sends an event on the bus, logging failures of synchronous subscribers
+func publish(ctx context.Context, p events.Payload) {
+	if err := events.Publish(ctx, p); err != nil {
+		log.Printf("Publishing %s: %v", p.EventType(), err)
+	}
+}
+
+// eventFile strips secrets from a file before it is put in an event, since
+// events are stored in the outbox
+func eventFile(file models.File) models.File {
+	file.DownloadToken = ""
+	return file
+}
+
+// PublishExpiredFiles publishes FileExpired once for each file past its expiry time
+func PublishExpiredFiles() (int, error) {
+	collection := db.Collection("files")
+
+	cursor, err := collection.Find(context.TODO(), bson.M{
+		"expires_at":        bson.M{"$lte": time.Now()},
+		"expiry_event_sent": bson.M{"$ne": true},
+		"deleted_at":        bson.M{"$exists": false},
+	}, options.Find().SetLimit(500))
+	if err != nil {
+		return 0, fmt.Errorf("failed to find expired files: %w", err)
+	}
+	defer cursor.Close(context.TODO())
+
+	var files []models.File
+	if err = cursor.All(context.TODO(), &files); err != nil {
+		return 0, fmt.Errorf("error decoding expired files: %w", err)
+	}
+
+	published := 0
+	for _, file := range files {
+		// Claim the event first so overlapping runs cannot send it twice
+		result, err := collection.UpdateOne(context.TODO(),
+			bson.M{"_id": file.ID, "expiry_event_sent": bson.M{"$ne": true}},
+			bson.M{"$set": bson.M{"expiry_event_sent": true}})
+		if err != nil || result.ModifiedCount == 0 {
+			continue
+		}
+
+		publish(context.TODO(), events.FileExpired{File: eventFile(file)})
+		published++
+	}
+	return published, nil
+}
+
+// StartFileExpiryWatcher runs PublishExpiredFiles every interval until ctx is cancelled
+func StartFileExpiryWatcher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if published, err := PublishExpiredFiles(); err != nil {
+			log.Printf("File expiry check failed: %v", err)
+		} else if published > 0 {
+			log.Printf("Published %d file expiry events", published)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arzan03/SecureShare/internal/db"
+	"github.com/arzan03/SecureShare/internal/events"
+	"github.com/arzan03/SecureShare/internal/models"
+	"github.com/arzan03/SecureShare/internal/storage"
+	"github.com/minio/minio-go/v7"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const maxFilenameLength = 255
+
+// validateFilename checks a display filename supplied by a user
+func validateFilename(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("filename is required")
+	}
+	if len(name) > maxFilenameLength {
+		return "", fmt.Errorf("filename is longer than %d characters", maxFilenameLength)
+	}
+	if strings.ContainsAny(name, "/\\\x00") {
+		return "", errors.New("filename may not contain path separators")
+	}
+	return name, nil
+}
+
+// RenameFile changes the display name of a file; the stored object is untouched
+func RenameFile(fileID, userID, newName string) (models.File, error) {
+	name, err := validateFilename(newName)
+	if err != nil {
+		return models.File{}, err
+	}
+
+	file, err := loadFile(fileID, userID, AccessEdit)
+	if err != nil {
+		return models.File{}, err
+	}
+
+	// Pin the object key first so legacy files keep pointing at their object after the rename
+	key := objectKey(file)
+	collection := db.Collection("files")
+	_, err = collection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": file.ID},
+		bson.M{"$set": bson.M{"filename": name, "object_key": key}},
+	)
+	if err != nil {
+		return models.File{}, fmt.Errorf("failed to rename file: %w", err)
+	}
+
+	file.Filename = name
+	file.ObjectKey = key
+	return file, nil
+}
+
+// CopyFile duplicates a file server-side into a new record uploaded by the calling user
+func CopyFile(ctx context.Context, fileID, userID, newName string) (models.File, error) {
+	file, err := loadFile(fileID, userID, AccessEdit)
+	if err != nil {
+		return models.File{}, err
+	}
+
+	name := "Copy of " + file.Filename
+	if newName != "" {
+		if name, err = validateFilename(newName); err != nil {
+			return models.File{}, err
+		}
+	}
+
+	// Copies of team files stay in the team and count towards its quota
+	if file.TeamID != "" {
+		team, err := RequireTeamRole(file.TeamID, userID, TeamRoleMember)
+		if err != nil {
+			return models.File{}, err
+		}
+		if err := checkTeamQuota(team, file.Size); err != nil {
+			return models.File{}, err
+		}
+	}
+
+	copyID := primitive.NewObjectID()
+	copyKey := copyID.Hex()
+
+	_, err = storage.MinioClient.CopyObject(
+		context.Background(),
+		minio.CopyDestOptions{Bucket: storage.Bucket, Object: copyKey},
+		minio.CopySrcOptions{Bucket: storage.Bucket, Object: objectKey(file)},
+	)
+	if err != nil {
+		return models.File{}, fmt.Errorf("failed to copy file in storage: %w", err)
+	}
+
+	duplicate := models.File{
+		ID:          copyID,
+		Filename:    name,
+		ObjectKey:   copyKey,
+		Size:        file.Size,
+		ContentType: file.ContentType,
+		Description: file.Description,
+		Tags:        file.Tags,
+		Metadata:    file.Metadata,
+		URL:         strings.Replace(file.URL, objectKey(file), copyKey, 1),
+		Owner:       userID,
+		TeamID:      file.TeamID,
+		ExpiresAt:   file.ExpiresAt,
+		CreatedAt:   time.Now(),
+	}
+
+	collection := db.Collection("files")
+	if _, err = collection.InsertOne(context.TODO(), duplicate); err != nil {
+		// Don't leave the copied object behind without a record
+		runBackground(func(context.Context) {
+			storage.MinioClient.RemoveObject(context.Background(), storage.Bucket, copyKey, minio.RemoveObjectOptions{})
+		})
+		return models.File{}, fmt.Errorf("failed to save file metadata: %w", err)
+	}
+
+	publish(ctx, events.FileUploaded{File: eventFile(duplicate), ActorID: userID, CopiedFrom: fileID})
+	return duplicate, nil
+}
+
+// TransferFile hands ownership of a file to the user with the given email.
+// Outstanding download links are revoked so the new owner decides who keeps access.
+func TransferFile(ctx context.Context, fileID, userID, recipientEmail string) (models.File, error) {
+	file, err := loadFile(fileID, userID, AccessOwner)
+	if err != nil {
+		return models.File{}, err
+	}
+	if file.TeamID != "" {
+		return models.File{}, errors.New("team files cannot be transferred to a user")
+	}
+
+	recipient, err := FindUserByEmail(recipientEmail)
+	if err != nil {
+		return models.File{}, errors.New("recipient not found")
+	}
+	if recipient.ID.Hex() == userID {
+		return models.File{}, errors.New("file is already owned by this user")
+	}
+
+	collection := db.Collection("files")
+	result, err := collection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": file.ID, "owner": userID, "team_id": bson.M{"$exists": false}},
+		bson.M{
+			"$set":   bson.M{"owner": recipient.ID.Hex(), "object_key": objectKey(file)},
+			"$unset": bson.M{"download_token": ""},
+			"$pull":  bson.M{"shares": bson.M{"user_id": recipient.ID.Hex()}}, // The new owner no longer needs a grant
+		},
+	)
+	if err != nil {
+		return models.File{}, fmt.Errorf("failed to transfer file: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return models.File{}, ErrFileNotFound // Deleted or handed over meanwhile
+	}
+
+	file.Owner = recipient.ID.Hex()
+	file.ObjectKey = objectKey(file)
+	file.DownloadToken = ""
+	publish(ctx, events.FileTransferred{File: eventFile(file), ActorID: userID, PreviousOwner: userID})
+	return file, nil
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/arzan03/SecureShare/internal/db"
+	"github.com/arzan03/SecureShare/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// ErrInvalidListOptions is returned for unknown sort fields or malformed cursors
+var ErrInvalidListOptions = errors.New("invalid listing options")
+
+// sortFields maps the public sort keys to document fields
+var sortFields = map[string]string{
+	"name":       "filename",
+	"size":       "size",
+	"created_at": "created_at",
+	"expiry":     "expires_at",
+}
+
+// FileListOptions controls filtering, sorting and paging of a file listing
+type FileListOptions struct {
+	SortBy         string // name, size, created_at or expiry
+	Descending     bool
+	Limit          int64
+	Cursor         string // Opaque cursor returned as NextCursor by the previous page
+	Name           string // Case-insensitive filename substring
+	ContentType    string
+	CreatedAfter   time.Time
+	CreatedBefore  time.Time
+	ExpiringWithin time.Duration     // Only files expiring between now and now+ExpiringWithin
+	Tags           []string          // Files must carry every one of these tags
+	Metadata       map[string]string // Files must have these exact metadata values
+}
+
+// FilePage is a single page of a file listing
+type FilePage struct {
+	Files      []models.File `json:"files"`
+	Total      int64         `json:"total"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// pageCursor is the position of the last file of a page in the sort order
+type pageCursor struct {
+	Value interface{}        `bson:"v"`
+	ID    primitive.ObjectID `bson:"id"`
+}
+
+func encodeCursor(c pageCursor) (string, error) {
+	raw, err := bson.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	var c pageCursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, fmt.Errorf("%w: invalid cursor", ErrInvalidListOptions)
+	}
+	if err := bson.Unmarshal(raw, &c); err != nil {
+		return c, fmt.Errorf("%w: invalid cursor", ErrInvalidListOptions)
+	}
+	return c, nil
+}
+
+// sortValue returns the value of the sort field in a stored file. Files
+// written before a field existed lack it, so nil is returned for them, which
+// MongoDB sorts like null: before every value ascending, after them descending.
+func sortValue(doc bson.Raw, field string) interface{} {
+	value, err := doc.LookupErr(field)
+	if err != nil || value.Type == bsontype.Null {
+		return nil
+	}
+	return value
+}
+
+// applyFilters adds the option filters to the base query
+func (opts FileListOptions) applyFilters(query bson.M) {
+	if opts.Name != "" {
+		query["filename"] = bson.M{"$regex": regexp.QuoteMeta(opts.Name), "$options": "i"}
+	}
+	if opts.ContentType != "" {
+		query["content_type"] = opts.ContentType
+	}
+
+	created := bson.M{}
+	if !opts.CreatedAfter.IsZero() {
+		created["$gte"] = opts.CreatedAfter
+	}
+	if !opts.CreatedBefore.IsZero() {
+		created["$lte"] = opts.CreatedBefore
+	}
+	if len(created) > 0 {
+		query["created_at"] = created
+	}
+
+	if opts.ExpiringWithin > 0 {
+		now := time.Now()
+		query["expires_at"] = bson.M{"$gte": now, "$lte": now.Add(opts.ExpiringWithin)}
+	}
+
+	if len(opts.Tags) > 0 {
+		query["tags"] = bson.M{"$all": opts.Tags}
+	}
+	for key, value := range opts.Metadata {
+		query["metadata."+key] = value
+	}
+}
+
+// ListFiles returns one page of the files matching base and the listing options
+func ListFiles(base bson.M, opts FileListOptions) (FilePage, error) {
+	field, ok := sortFields[opts.SortBy]
+	if opts.SortBy == "" {
+		field, ok = "created_at", true
+	}
+	if !ok {
+		return FilePage{}, fmt.Errorf("%w: invalid sort field %s", ErrInvalidListOptions, opts.SortBy)
+	}
+
+	if opts.Tags != nil {
+		tags, err := normalizeTags(opts.Tags)
+		if err != nil {
+			return FilePage{}, fmt.Errorf("%w: %v", ErrInvalidListOptions, err)
+		}
+		opts.Tags = tags
+	}
+	for key := range opts.Metadata {
+		if !metadataKeyPattern.MatchString(key) {
+			return FilePage{}, fmt.Errorf("%w: invalid metadata key %q", ErrInvalidListOptions, key)
+		}
+	}
+
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultPageSize
+	}
+	if opts.Limit > MaxPageSize {
+		opts.Limit = MaxPageSize
+	}
+
+	query := bson.M{}
+	for k, v := range base {
+		query[k] = v
+	}
+	opts.applyFilters(query)
+
+	collection := db.Collection("files")
+
+	total, err := collection.CountDocuments(context.TODO(), query)
+	if err != nil {
+		return FilePage{}, fmt.Errorf("failed to count files: %w", err)
+	}
+
+	order, cmp := 1, "$gt"
+	if opts.Descending {
+		order, cmp = -1, "$lt"
+	}
+
+	// Resume strictly after the last file of the previous page, using _id as a tie breaker
+	pageQuery := query
+	if opts.Cursor != "" {
+		cur, err := decodeCursor(opts.Cursor)
+		if err != nil {
+			return FilePage{}, err
+		}
+		// Range operators never match null, so files missing the field are matched explicitly
+		after := bson.A{bson.M{field: cur.Value, "_id": bson.M{cmp: cur.ID}}}
+		switch {
+		case cur.Value == nil && !opts.Descending:
+			after = append(after, bson.M{field: bson.M{"$ne": nil}})
+		case cur.Value == nil:
+			// Nothing sorts after null in descending order
+		case opts.Descending:
+			after = append(after, bson.M{field: bson.M{cmp: cur.Value}}, bson.M{field: nil})
+		default:
+			after = append(after, bson.M{field: bson.M{cmp: cur.Value}})
+		}
+		pageQuery = bson.M{"$and": bson.A{query, bson.M{"$or": after}}}
+	}
+
+	findOpts := options.Find().
+		SetSort(bson.D{{Key: field, Value: order}, {Key: "_id", Value: order}}).
+		SetLimit(opts.Limit + 1) // One extra to know whether another page exists
+
+	cursor, err := collection.Find(context.TODO(), pageQuery, findOpts)
+	if err != nil {
+		return FilePage{}, fmt.Errorf("failed to retrieve files: %w", err)
+	}
+	defer cursor.Close(context.TODO())
+
+	// Documents are kept raw as well, to tell a missing sort field from a zero value
+	var docs []bson.Raw
+	if err = cursor.All(context.TODO(), &docs); err != nil {
+		return FilePage{}, fmt.Errorf("error retrieving files: %w", err)
+	}
+	files := make([]models.File, len(docs))
+	for i, doc := range docs {
+		if err := bson.Unmarshal(doc, &files[i]); err != nil {
+			return FilePage{}, fmt.Errorf("error decoding file metadata: %w", err)
+		}
+	}
+
+	page := FilePage{Files: files, Total: total}
+	if int64(len(files)) > opts.Limit {
+		page.Files = files[:opts.Limit]
+		last := page.Files[len(page.Files)-1]
+		page.NextCursor, err = encodeCursor(pageCursor{Value: sortValue(docs[opts.Limit-1], field), ID: last.ID})
+		if err != nil {
+			return FilePage{}, fmt.Errorf("failed to build cursor: %w", err)
+		}
+	}
+
+	return page, nil
+}
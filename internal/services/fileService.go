@@ -8,11 +8,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"os"
+	"mime/multipart"
+	"net/url"
 	"sync"
 	"time"
 
 	"github.com/arzan03/SecureShare/internal/db"
+	"github.com/arzan03/SecureShare/internal/events"
 	"github.com/arzan03/SecureShare/internal/models"
 	"github.com/arzan03/SecureShare/internal/storage"
 	"github.com/gofiber/fiber/v2"
@@ -30,26 +32,74 @@ func generateSecureToken() (string, error) {
 	return hex.EncodeToString(token), nil
 }
 
+// objectKey returns the MinIO object name of a file. Files stored before the key was
+// recorded explicitly still use the legacy fileID_filename naming.
+func objectKey(file models.File) string {
+	if file.ObjectKey != "" {
+		return file.ObjectKey
+	}
+	return fmt.Sprintf("%s_%s", file.ID.Hex(), file.Filename)
+}
+
+// readUploadedFile reads the full contents of a multipart file
+func readUploadedFile(fileHeader *multipart.FileHeader) ([]byte, error) {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, errors.New("failed to open file")
+	}
+	defer file.Close()
+
+	fileBytes, err := io.ReadAll(file)
+	if err != nil {
+		return nil, errors.New("failed to read file")
+	}
+	return fileBytes, nil
+}
+
 func UploadFile(c *fiber.Ctx, userID string) (models.File, error) {
 	fileHeader, err := c.FormFile("file")
 	if err != nil {
 		return models.File{}, errors.New("failed to retrieve file")
 	}
 
-	file, err := fileHeader.Open()
+	fileBytes, err := readUploadedFile(fileHeader)
 	if err != nil {
-		return models.File{}, errors.New("failed to open file")
+		return models.File{}, err
 	}
-	defer file.Close()
 
-	fileBytes, err := io.ReadAll(file)
+	description, tags, metadata, err := parseUploadMetadata(c.FormValue("description"), c.FormValue("tags"), c.FormValue("metadata"))
 	if err != nil {
-		return models.File{}, errors.New("failed to read file")
+		return models.File{}, err
+	}
+
+	// Uploads into a team space need member rights and must fit the team quota
+	teamID := c.FormValue("team_id")
+	if teamID != "" {
+		team, err := RequireTeamRole(teamID, userID, TeamRoleMember)
+		if err != nil {
+			return models.File{}, err
+		}
+		if err := checkTeamQuota(team, int64(len(fileBytes))); err != nil {
+			return models.File{}, err
+		}
 	}
 
+	return storeFile(c.UserContext(), models.File{
+		Filename:    fileHeader.Filename,
+		ContentType: fileHeader.Header.Get("Content-Type"),
+		Description: description,
+		Tags:        tags,
+		Metadata:    metadata,
+		Owner:       userID,
+		TeamID:      teamID,
+	}, fileBytes)
+}
+
+// storeFile uploads the object and saves its metadata record in parallel. fileData
+// carries the descriptive fields; IDs, timestamps and the initial token are filled in here.
+func storeFile(ctx context.Context, fileData models.File, fileBytes []byte) (models.File, error) {
 	fileID := primitive.NewObjectID()
-	bucketName := "secure-files"
-	objectName := fmt.Sprintf("%s_%s", fileID.Hex(), fileHeader.Filename)
+	objectName := fileID.Hex()
 
 	// Create channels for parallel execution results
 	minioResultChan := make(chan error, 1)
@@ -64,33 +114,31 @@ func UploadFile(c *fiber.Ctx, userID string) (models.File, error) {
 		return models.File{}, errors.New("failed to generate secure token")
 	}
 
-	fileData := models.File{
-		ID:            fileID,
-		Filename:      fileHeader.Filename,
-		URL:           fmt.Sprintf("http://%s/%s/%s", os.Getenv("MINIO_ENDPOINT"), bucketName, objectName),
-		Owner:         userID,
-		ExpiresAt:     time.Now().Add(24 * time.Hour),
-		CreatedAt:     time.Now(),
-		DownloadToken: secureToken,
-		TokenType:     "time-limited",
-		TokenExpires:  time.Now().Add(24 * time.Hour),
-	}
+	fileData.ID = fileID
+	fileData.ObjectKey = objectName
+	fileData.Size = int64(len(fileBytes))
+	fileData.URL = storage.ObjectURL(objectName)
+	fileData.ExpiresAt = time.Now().Add(24 * time.Hour)
+	fileData.CreatedAt = time.Now()
+	fileData.DownloadToken = secureToken
+	fileData.TokenType = "time-limited"
+	fileData.TokenExpires = time.Now().Add(24 * time.Hour)
 
 	// Execute file upload and metadata creation in parallel
 	go func() {
 		_, err := storage.MinioClient.PutObject(
 			context.Background(),
-			bucketName,
+			storage.Bucket,
 			objectName,
 			bytes.NewReader(fileBytes),
 			int64(len(fileBytes)),
-			minio.PutObjectOptions{ContentType: fileHeader.Header.Get("Content-Type")},
+			minio.PutObjectOptions{ContentType: fileData.ContentType},
 		)
 		minioResultChan <- err
 	}()
 
 	go func() {
-		collection := db.GetCollection("secure_files", "files")
+		collection := db.Collection("files")
 		_, err := collection.InsertOne(context.TODO(), fileData)
 		metadataResultChan <- struct {
 			fileData models.File
@@ -108,17 +156,19 @@ func UploadFile(c *fiber.Ctx, userID string) (models.File, error) {
 
 	if metadataResult.err != nil {
 		// Try to clean up the uploaded file if metadata creation fails
-		go func() {
-			storage.MinioClient.RemoveObject(context.Background(), bucketName, objectName, minio.RemoveObjectOptions{})
-		}()
+		runBackground(func(context.Context) {
+			storage.MinioClient.RemoveObject(context.Background(), storage.Bucket, objectName, minio.RemoveObjectOptions{})
+		})
 		return models.File{}, errors.New("failed to save file metadata: " + metadataResult.err.Error())
 	}
 
+	publish(ctx, events.FileUploaded{File: eventFile(fileData)})
+
 	return fileData, nil
 }
 
 // BatchGeneratePresignedURLs processes multiple files in parallel
-func BatchGeneratePresignedURLs(fileIDs []string, userID string, tokenType string, duration time.Duration) (map[string]string, []error) {
+func BatchGeneratePresignedURLs(ctx context.Context, fileIDs []string, userID string, tokenType string, duration time.Duration, restrictions LinkRestrictions) (map[string]string, []error) {
 	results := make(map[string]string)
 	errs := make([]error, 0)
 	resultMutex := sync.RWMutex{}
@@ -129,7 +179,7 @@ func BatchGeneratePresignedURLs(fileIDs []string, userID string, tokenType strin
 	for _, fileID := range fileIDs {
 		go func(fid string) {
 			defer wg.Done()
-			url, err := GeneratePresignedURL(fid, userID, tokenType, duration)
+			url, err := GeneratePresignedURL(ctx, fid, userID, tokenType, duration, restrictions)
 			resultMutex.Lock()
 			if err != nil {
 				errs = append(errs, fmt.Errorf("error for file %s: %w", fid, err))
@@ -145,54 +195,120 @@ func BatchGeneratePresignedURLs(fileIDs []string, userID string, tokenType strin
 }
 
 // GeneratePresignedURL creates a presigned URL with security measures.
-func GeneratePresignedURL(fileID, userID, tokenType string, duration time.Duration) (string, error) {
-	objID, err := primitive.ObjectIDFromHex(fileID)
+// Restrictions replace those of any previous link for the file.
+func GeneratePresignedURL(ctx context.Context, fileID, userID, tokenType string, duration time.Duration, restrictions LinkRestrictions) (string, error) {
+	restrictions, err := restrictions.normalize()
 	if err != nil {
-		return "", fmt.Errorf("invalid file ID: %w", err)
+		return "", err
 	}
 
-	collection := db.GetCollection("secure_files", "files")
-	var fileData models.File
+	// Creating a link replaces the current one, so viewers may not do it
+	fileData, err := loadFile(fileID, userID, AccessEdit)
+	if err != nil {
+		return "", err
+	}
+	return createShareLink(ctx, fileData, userID, false, true, tokenType, duration, restrictions)
+}
 
-	err = collection.FindOne(context.TODO(), bson.M{"_id": objID}).Decode(&fileData)
+// AdminGeneratePresignedURL creates a share link for any file on an admin's
+// behalf. A link the owner handed out is only replaced when replace is set.
+func AdminGeneratePresignedURL(fileID, adminID, tokenType string, duration time.Duration, restrictions LinkRestrictions, replace bool) (string, error) {
+	restrictions, err := restrictions.normalize()
 	if err != nil {
-		return "", fmt.Errorf("file not found: %w", err)
+		return "", err
 	}
 
-	if fileData.Owner != userID {
-		return "", errors.New("unauthorized access")
+	fileData, err := loadFileAsAdmin(fileID)
+	if err != nil {
+		return "", err
 	}
+	return createShareLink(context.TODO(), fileData, adminID, true, replace, tokenType, duration, restrictions)
+}
+
+// createShareLink stores a new share link on a loaded file and returns its URL.
+// byAdmin marks links an admin created for someone else's file; without
+// replace, an unexpired link is kept and ErrLinkActive returned.
+func createShareLink(ctx context.Context, fileData models.File, actorID string, byAdmin, replace bool, tokenType string, duration time.Duration, restrictions LinkRestrictions) (string, error) {
+	objID := fileData.ID
+	collection := db.Collection("files")
 
 	token, err := generateSecureToken()
 	if err != nil {
 		return "", err
 	}
 
-	// Adjust expiration based on token type
-	tokenExpires := time.Now().Add(duration)
+	// Adjust expiration based on token type; the window opens when any embargo lifts
+	start := time.Now()
+	if !restrictions.NotBefore.IsZero() {
+		start = restrictions.NotBefore
+	}
+	tokenExpires := start.Add(duration)
 	if tokenType == "one-time" {
-		tokenExpires = time.Now().Add(30 * time.Minute)
-	}
-
-	_, err = collection.UpdateOne(
-		context.TODO(),
-		bson.M{"_id": objID},
-		bson.M{"$set": bson.M{
-			"download_token": token,
-			"token_type":     tokenType,
-			"token_expires":  tokenExpires,
-		}},
-	)
+		tokenExpires = start.Add(30 * time.Minute)
+	}
+
+	linkID := primitive.NewObjectID().Hex()
+	set := bson.M{
+		"link_id":        linkID,
+		"download_token": token,
+		"token_type":     tokenType,
+		"token_expires":  tokenExpires,
+	}
+	unset := bson.M{}
+	if restrictions.NotBefore.IsZero() {
+		unset["token_not_before"] = ""
+	} else {
+		set["token_not_before"] = restrictions.NotBefore
+	}
+	restrictionFields := map[string][]string{
+		"token_allowed_cidrs":     restrictions.AllowedCIDRs,
+		"token_denied_cidrs":      restrictions.DeniedCIDRs,
+		"token_allowed_referrers": restrictions.AllowedReferrers,
+	}
+	for field, values := range restrictionFields {
+		if len(values) > 0 {
+			set[field] = values
+		} else {
+			unset[field] = ""
+		}
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	filter := bson.M{"_id": objID}
+	if !replace {
+		filter["$or"] = bson.A{
+			bson.M{"download_token": bson.M{"$exists": false}},
+			bson.M{"token_expires": bson.M{"$lte": time.Now()}},
+		}
+	}
+	result, err := collection.UpdateOne(context.TODO(), filter, update)
 	if err != nil {
 		return "", fmt.Errorf("failed to save download token: %w", err)
 	}
+	if result.MatchedCount == 0 {
+		return "", ErrLinkActive
+	}
+
+	fileData.LinkID = linkID
+	fileData.TokenType = tokenType
+	fileData.TokenExpires = tokenExpires
+	fileData.TokenNotBefore = restrictions.NotBefore
+	publish(ctx, events.LinkCreated{File: eventFile(fileData), ActorID: actorID, AdminAccess: byAdmin})
+
+	// A direct storage URL would bypass the checks, so restricted links point
+	// at the validating download endpoint instead
+	if restrictions.active() {
+		return fmt.Sprintf("/file/download/%s?token=%s", objID.Hex(), url.QueryEscape(token)), nil
+	}
 
-	bucketName := "secure-files"
-	objectName := fmt.Sprintf("%s_%s", fileID, fileData.Filename)
+	objectName := objectKey(fileData)
 	expiry := duration
 
 	reqParams := map[string][]string{"token": {token}}
-	url, err := storage.MinioClient.PresignedGetObject(context.Background(), bucketName, objectName, expiry, reqParams)
+	url, err := storage.MinioClient.PresignedGetObject(context.Background(), storage.Bucket, objectName, expiry, reqParams)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate presigned URL: %w", err)
 	}
@@ -200,47 +316,75 @@ func GeneratePresignedURL(fileID, userID, tokenType string, duration time.Durati
 	return url.String(), nil
 }
 
-// ValidateDownload verifies the token and generates a presigned MinIO download link.
-func ValidateDownload(fileID, providedToken string) (string, error) {
+// ValidateDownload verifies the token, its embargo and expiry and the link's
+// network and referrer restrictions, then generates a presigned MinIO download link.
+func ValidateDownload(ctx context.Context, fileID, providedToken string, client DownloadClient) (string, error) {
 	objID, err := primitive.ObjectIDFromHex(fileID)
 	if err != nil {
 		return "", fmt.Errorf("invalid file ID: %w", err)
 	}
 
-	collection := db.GetCollection("secure_files", "files")
+	collection := db.Collection("files")
 	var fileData models.File
 
-	err = collection.FindOne(context.TODO(), bson.M{"_id": objID}).Decode(&fileData)
+	err = collection.FindOne(context.TODO(), bson.M{"_id": objID, "deleted_at": bson.M{"$exists": false}}).Decode(&fileData)
 	if err != nil {
 		return "", fmt.Errorf("file not found: %w", err)
 	}
 
-	if fileData.DownloadToken != providedToken {
+	// Failures are logged against the file but not the link, since a wrong
+	// token does not identify one
+	if fileData.DownloadToken == "" || fileData.DownloadToken != providedToken {
+		recordAccess(fileData, "", client, "invalid token")
 		return "", errors.New("invalid or expired download token")
 	}
+	linkID := fileData.LinkID
+
+	if time.Now().Before(fileData.TokenNotBefore) {
+		recordAccess(fileData, linkID, client, "not yet available")
+		return "", fmt.Errorf("%w: available from %s", ErrLinkNotYetAvailable, fileData.TokenNotBefore.UTC().Format(time.RFC3339))
+	}
 
 	if fileData.TokenType == "time-limited" && time.Now().After(fileData.TokenExpires) {
+		recordAccess(fileData, linkID, client, "token expired")
 		return "", errors.New("download token expired")
 	}
 
-	// Revoke one-time token after first use
+	if reason := checkLinkRestrictions(fileData, client); reason != "" {
+		recordAccess(fileData, linkID, client, reason)
+		return "", ErrLinkRestricted
+	}
+
+	// Revoke one-time token after first use. Matching on the token means only
+	// one of several concurrent redemptions can consume it.
 	if fileData.TokenType == "one-time" {
-		_, err = collection.UpdateOne(
+		result, err := collection.UpdateOne(
 			context.TODO(),
-			bson.M{"_id": objID},
+			bson.M{"_id": objID, "download_token": providedToken},
 			bson.M{"$unset": bson.M{"download_token": ""}}, // `unset` is better than setting empty string
 		)
 		if err != nil {
 			return "", fmt.Errorf("failed to revoke token: %w", err)
 		}
+		if result.ModifiedCount == 0 {
+			recordAccess(fileData, linkID, client, "token already used")
+			return "", errors.New("invalid or expired download token")
+		}
 	}
 
+	recordAccess(fileData, linkID, client, "")
+	publish(ctx, events.LinkRedeemed{
+		File:      eventFile(fileData),
+		UserID:    client.UserID,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+	})
+
 	// Generate MinIO presigned URL
-	bucketName := "secure-files"
-	objectName := fmt.Sprintf("%s_%s", fileID, fileData.Filename)
+	objectName := objectKey(fileData)
 	expiry := 10 * time.Minute
 
-	url, err := storage.MinioClient.PresignedGetObject(context.Background(), bucketName, objectName, expiry, nil)
+	url, err := storage.MinioClient.PresignedGetObject(context.Background(), storage.Bucket, objectName, expiry, nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate download link: %w", err)
 	}
@@ -248,36 +392,25 @@ func ValidateDownload(fileID, providedToken string) (string, error) {
 	return url.String(), nil
 }
 
-// DeleteFileParallel deletes a file from both MinIO and MongoDB in parallel
-func DeleteFileParallel(fileID, userID string) error {
-	objID, err := primitive.ObjectIDFromHex(fileID)
-	if err != nil {
-		return fmt.Errorf("invalid file ID: %w", err)
-	}
-
-	collection := db.GetCollection("secure_files", "files")
-	var file models.File
-	err = collection.FindOne(context.TODO(), bson.M{"_id": objID, "owner": userID}).Decode(&file)
-	if err != nil {
-		return fmt.Errorf("file not found or access denied: %w", err)
-	}
+// removeFileParallel permanently deletes a file from both MinIO and MongoDB in parallel
+func removeFileParallel(ctx context.Context, file models.File, actorID string) error {
+	collection := db.Collection("files")
 
 	// Create channels for parallel deletion results
 	minioDeleteChan := make(chan error, 1)
 	mongoDeleteChan := make(chan error, 1)
 
-	bucketName := "secure-files"
-	objectName := fmt.Sprintf("%s_%s", fileID, file.Filename)
+	objectName := objectKey(file)
 
 	// Delete from MinIO in parallel
 	go func() {
-		err := storage.MinioClient.RemoveObject(context.TODO(), bucketName, objectName, minio.RemoveObjectOptions{})
+		err := storage.MinioClient.RemoveObject(context.TODO(), storage.Bucket, objectName, minio.RemoveObjectOptions{})
 		minioDeleteChan <- err
 	}()
 
 	// Delete from MongoDB in parallel
 	go func() {
-		_, err := collection.DeleteOne(context.TODO(), bson.M{"_id": objID})
+		_, err := collection.DeleteOne(context.TODO(), bson.M{"_id": file.ID})
 		mongoDeleteChan <- err
 	}()
 
@@ -294,42 +427,12 @@ func DeleteFileParallel(fileID, userID string) error {
 		return fmt.Errorf("failed to delete from database: %w", mongoErr)
 	}
 
+	publish(ctx, events.FileDeleted{File: eventFile(file), ActorID: actorID, Permanent: true})
+
 	return nil
 }
 
-// ListFilesWithMetadata gets all files for a user with parallel metadata fetching
-func ListFilesWithMetadata(userID string) ([]models.File, error) {
-	collection := db.GetCollection("secure_files", "files")
-
-	cursor, err := collection.Find(context.TODO(), bson.M{"owner": userID})
-	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve files: %w", err)
-	}
-	defer cursor.Close(context.TODO())
-
-	var files []models.File
-	if err = cursor.All(context.TODO(), &files); err != nil {
-		return nil, fmt.Errorf("error decoding file metadata: %w", err)
-	}
-
-	// For each file, fetch additional metadata in parallel if needed
-	// This is a placeholder for any additional enrichment that might be needed
-	if len(files) > 0 {
-		var wg sync.WaitGroup
-		wg.Add(len(files))
-
-		for i := range files {
-			go func(index int) {
-				defer wg.Done()
-				// Here you could enrich each file with additional data
-				// For example, checking if it exists in MinIO
-
-				// This is just a placeholder, no actual enrichment needed for now
-			}(i)
-		}
-
-		wg.Wait()
-	}
-
-	return files, nil
+// ListFilesWithMetadata returns one page of a user's personal files
+func ListFilesWithMetadata(userID string, opts FileListOptions) (FilePage, error) {
+	return ListFiles(bson.M{"owner": userID, "team_id": bson.M{"$exists": false}, "deleted_at": bson.M{"$exists": false}}, opts)
 }
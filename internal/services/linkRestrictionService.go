@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/arzan03/SecureShare/internal/db"
+	"github.com/arzan03/SecureShare/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const maxLinkRestrictionEntries = 50
+
+var (
+	ErrLinkRestricted      = errors.New("download not permitted from this location")
+	ErrLinkNotYetAvailable = errors.New("download not yet available")
+	ErrNoActiveLink        = errors.New("file has no active share link")
+	ErrLinkNotEmbargoed    = errors.New("share link has no embargo to reschedule")
+	ErrLinkActive          = errors.New("file already has an active share link; pass replace=true to replace it")
+)
+
+// LinkRestrictions limits where and when a share link may be redeemed
+type LinkRestrictions struct {
+	AllowedCIDRs     []string  `json:"allowed_cidrs"`
+	DeniedCIDRs      []string  `json:"denied_cidrs"`
+	AllowedReferrers []string  `json:"allowed_referrers"`
+	NotBefore        time.Time `json:"not_before"` // Embargo; zero or past means available immediately
+}
+
+// DownloadClient describes who is redeeming a share link
+type DownloadClient struct {
+	UserID    string
+	IP        string
+	Referer   string
+	UserAgent string
+}
+
+// normalizeCIDRs validates networks and returns them in canonical form; bare addresses become single-host networks
+func normalizeCIDRs(values []string) ([]string, error) {
+	if len(values) > maxLinkRestrictionEntries {
+		return nil, fmt.Errorf("at most %d networks allowed", maxLinkRestrictionEntries)
+	}
+
+	cidrs := []string{}
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			addr, err := netip.ParseAddr(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid network %q", v)
+			}
+			cidrs = append(cidrs, netip.PrefixFrom(addr, addr.BitLen()).String())
+			continue
+		}
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", v)
+		}
+		cidrs = append(cidrs, prefix.Masked().String())
+	}
+	return cidrs, nil
+}
+
+// normalizeReferrers lowercases referrer host patterns and rejects anything that is not a host
+func normalizeReferrers(values []string) ([]string, error) {
+	if len(values) > maxLinkRestrictionEntries {
+		return nil, fmt.Errorf("at most %d referrers allowed", maxLinkRestrictionEntries)
+	}
+
+	hosts := []string{}
+	for _, v := range values {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if v == "" {
+			continue
+		}
+		if strings.ContainsAny(v, "/:?# ") || strings.Contains(strings.TrimPrefix(v, "*."), "*") {
+			return nil, fmt.Errorf("invalid referrer host %q", v)
+		}
+		hosts = append(hosts, v)
+	}
+	return hosts, nil
+}
+
+// normalize validates every restriction list
+func (r LinkRestrictions) normalize() (LinkRestrictions, error) {
+	allowed, err := normalizeCIDRs(r.AllowedCIDRs)
+	if err != nil {
+		return LinkRestrictions{}, err
+	}
+	denied, err := normalizeCIDRs(r.DeniedCIDRs)
+	if err != nil {
+		return LinkRestrictions{}, err
+	}
+	referrers, err := normalizeReferrers(r.AllowedReferrers)
+	if err != nil {
+		return LinkRestrictions{}, err
+	}
+
+	notBefore := r.NotBefore
+	if !notBefore.After(time.Now()) {
+		notBefore = time.Time{}
+	}
+
+	return LinkRestrictions{
+		AllowedCIDRs:     allowed,
+		DeniedCIDRs:      denied,
+		AllowedReferrers: referrers,
+		NotBefore:        notBefore,
+	}, nil
+}
+
+// active reports whether any restriction is set
+func (r LinkRestrictions) active() bool {
+	return len(r.AllowedCIDRs) > 0 || len(r.DeniedCIDRs) > 0 || len(r.AllowedReferrers) > 0 || !r.NotBefore.IsZero()
+}
+
+// inAnyNetwork reports whether addr falls inside one of the networks
+func inAnyNetwork(addr netip.Addr, cidrs []string) bool {
+	for _, c := range cidrs {
+		if prefix, err := netip.ParsePrefix(c); err == nil && prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// referrerAllowed matches the referring page's host against exact or "*.domain" patterns
+func referrerAllowed(referer string, allowed []string) bool {
+	u, err := url.Parse(referer)
+	if err != nil || u.Hostname() == "" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+
+	for _, a := range allowed {
+		if suffix, ok := strings.CutPrefix(a, "*"); ok {
+			if strings.HasSuffix(host, suffix) {
+				return true
+			}
+		} else if host == a {
+			return true
+		}
+	}
+	return false
+}
+
+// checkLinkRestrictions returns the reason a client may not redeem the file's link, or "" if it may
+func checkLinkRestrictions(file models.File, client DownloadClient) string {
+	if len(file.TokenAllowedCIDRs) > 0 || len(file.TokenDeniedCIDRs) > 0 {
+		addr, err := netip.ParseAddr(client.IP)
+		if err != nil {
+			return "unknown client address"
+		}
+		addr = addr.Unmap() // IPv4 clients seen over IPv6 sockets
+		if inAnyNetwork(addr, file.TokenDeniedCIDRs) {
+			return "address is denied"
+		}
+		if len(file.TokenAllowedCIDRs) > 0 && !inAnyNetwork(addr, file.TokenAllowedCIDRs) {
+			return "address is not allowed"
+		}
+	}
+
+	if len(file.TokenAllowedReferrers) > 0 && !referrerAllowed(client.Referer, file.TokenAllowedReferrers) {
+		return "referrer is not allowed"
+	}
+
+	return ""
+}
+
+// RescheduleLink moves the embargo of a file's current share link. A
+// time-limited link keeps the length of its download window. A zero or past
+// time lifts the embargo. Only embargoed links can be rescheduled, since an
+// unrestricted link may already have been handed out as a direct storage URL.
+func RescheduleLink(fileID, userID string, notBefore time.Time) (models.File, error) {
+	file, err := loadFile(fileID, userID, AccessEdit)
+	if err != nil {
+		return models.File{}, err
+	}
+	if file.DownloadToken == "" {
+		return models.File{}, ErrNoActiveLink
+	}
+	if file.TokenNotBefore.IsZero() {
+		return models.File{}, ErrLinkNotEmbargoed
+	}
+
+	now := time.Now()
+	oldStart := file.TokenNotBefore
+	newStart := notBefore
+	if !newStart.After(now) {
+		newStart = now
+	}
+
+	set := bson.M{"token_expires": file.TokenExpires.Add(newStart.Sub(oldStart))}
+	update := bson.M{"$set": set}
+	if notBefore.After(now) {
+		set["token_not_before"] = notBefore
+	} else {
+		update["$unset"] = bson.M{"token_not_before": ""}
+	}
+
+	// Match the token too, so a link replaced in the meantime is left alone
+	collection := db.Collection("files")
+	var updated models.File
+	err = collection.FindOneAndUpdate(context.TODO(),
+		bson.M{"_id": file.ID, "download_token": file.DownloadToken},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		return models.File{}, ErrNoActiveLink
+	}
+	return updated, nil
+}
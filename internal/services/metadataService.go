@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/arzan03/SecureShare/internal/db"
+	"github.com/arzan03/SecureShare/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	maxTags           = 20
+	maxTagLength      = 50
+	maxMetadataKeys   = 20
+	maxMetadataValue  = 256
+	maxDescriptionLen = 1000
+)
+
+// Metadata keys become document field names, so they may not contain "." or "$"
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// FileMetadataUpdate holds the editable descriptive fields of a file.
+// Nil fields are left unchanged; a nil metadata value removes that key.
+type FileMetadataUpdate struct {
+	Description *string            `json:"description"`
+	Tags        *[]string          `json:"tags"`
+	Metadata    map[string]*string `json:"metadata"`
+}
+
+// normalizeTags trims, lowercases and de-duplicates tags
+func normalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool)
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > maxTagLength {
+			return nil, fmt.Errorf("tag %q is longer than %d characters", tag, maxTagLength)
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxTags {
+		return nil, fmt.Errorf("a file can have at most %d tags", maxTags)
+	}
+	return normalized, nil
+}
+
+// validateMetadata checks user-defined metadata keys and values
+func validateMetadata(metadata map[string]string) error {
+	if len(metadata) > maxMetadataKeys {
+		return fmt.Errorf("a file can have at most %d metadata keys", maxMetadataKeys)
+	}
+	for key, value := range metadata {
+		if !metadataKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid metadata key %q", key)
+		}
+		if len(value) > maxMetadataValue {
+			return fmt.Errorf("metadata value for %q is longer than %d characters", key, maxMetadataValue)
+		}
+	}
+	return nil
+}
+
+// parseUploadMetadata reads the optional description, tags and metadata form fields of an upload.
+// Tags are comma separated and metadata is a JSON object of string values.
+func parseUploadMetadata(description, tags, metadata string) (string, []string, map[string]string, error) {
+	if len(description) > maxDescriptionLen {
+		return "", nil, nil, fmt.Errorf("description is longer than %d characters", maxDescriptionLen)
+	}
+
+	var tagList []string
+	if tags != "" {
+		var err error
+		if tagList, err = normalizeTags(strings.Split(tags, ",")); err != nil {
+			return "", nil, nil, err
+		}
+	}
+
+	var meta map[string]string
+	if metadata != "" {
+		if err := json.Unmarshal([]byte(metadata), &meta); err != nil {
+			return "", nil, nil, errors.New("metadata must be a JSON object of string values")
+		}
+		if err := validateMetadata(meta); err != nil {
+			return "", nil, nil, err
+		}
+	}
+
+	return strings.TrimSpace(description), tagList, meta, nil
+}
+
+// UpdateFileMetadata applies a metadata update to a file the user can edit
+func UpdateFileMetadata(fileID, userID string, update FileMetadataUpdate) (models.File, error) {
+	file, err := loadFile(fileID, userID, AccessEdit)
+	if err != nil {
+		return models.File{}, err
+	}
+
+	collection := db.Collection("files")
+	filter := bson.M{"_id": file.ID, "deleted_at": bson.M{"$exists": false}}
+
+	set := bson.M{}
+	unset := bson.M{}
+
+	if update.Description != nil {
+		if len(*update.Description) > maxDescriptionLen {
+			return models.File{}, fmt.Errorf("description is longer than %d characters", maxDescriptionLen)
+		}
+		set["description"] = strings.TrimSpace(*update.Description)
+	}
+
+	if update.Tags != nil {
+		tags, err := normalizeTags(*update.Tags)
+		if err != nil {
+			return models.File{}, err
+		}
+		set["tags"] = tags
+	}
+
+	// Keys are changed one by one so concurrent updates to other keys are kept
+	added, removed := bson.A{}, bson.A{}
+	for key, value := range update.Metadata {
+		if !metadataKeyPattern.MatchString(key) {
+			return models.File{}, fmt.Errorf("invalid metadata key %q", key)
+		}
+		if value == nil {
+			unset["metadata."+key] = ""
+			removed = append(removed, key)
+			continue
+		}
+		if len(*value) > maxMetadataValue {
+			return models.File{}, fmt.Errorf("metadata value for %q is longer than %d characters", key, maxMetadataValue)
+		}
+		set["metadata."+key] = *value
+		added = append(added, key)
+	}
+	if len(added) > 0 {
+		// The key limit is checked against the stored keys as the update applies
+		stored := bson.M{"$map": bson.M{
+			"input": bson.M{"$objectToArray": bson.M{"$ifNull": bson.A{"$metadata", bson.M{}}}},
+			"in":    "$$this.k",
+		}}
+		filter["$expr"] = bson.M{"$lte": bson.A{
+			bson.M{"$size": bson.M{"$setUnion": bson.A{bson.M{"$setDifference": bson.A{stored, removed}}, added}}},
+			maxMetadataKeys,
+		}}
+	}
+
+	changes := bson.M{}
+	if len(set) > 0 {
+		changes["$set"] = set
+	}
+	if len(unset) > 0 {
+		changes["$unset"] = unset
+	}
+	if len(changes) == 0 {
+		return file, nil
+	}
+
+	var updated models.File
+	err = collection.FindOneAndUpdate(context.TODO(), filter, changes,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		// Either the file is gone or the update would exceed the key limit
+		if _, hasLimit := filter["$expr"]; hasLimit {
+			delete(filter, "$expr")
+			if n, countErr := collection.CountDocuments(context.TODO(), filter); countErr == nil && n > 0 {
+				return models.File{}, fmt.Errorf("a file can have at most %d metadata keys", maxMetadataKeys)
+			}
+		}
+		return models.File{}, ErrFileNotFound
+	}
+	if err != nil {
+		return models.File{}, fmt.Errorf("failed to update file metadata: %w", err)
+	}
+
+	return updated, nil
+}
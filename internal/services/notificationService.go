@@ -0,0 +1,302 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/arzan03/SecureShare/internal/db"
+	"github.com/arzan03/SecureShare/internal/events"
+	"github.com/arzan03/SecureShare/internal/mailer"
+	"github.com/arzan03/SecureShare/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// defaultNotificationPreferences applies until a user saves their own: no events, inbox delivery
+func defaultNotificationPreferences(userID string) models.NotificationPreferences {
+	return models.NotificationPreferences{UserID: userID, InApp: true}
+}
+
+// GetNotificationPreferences returns a user's notification preferences
+func GetNotificationPreferences(userID string) (models.NotificationPreferences, error) {
+	collection := db.Collection("notification_preferences")
+
+	var prefs models.NotificationPreferences
+	err := collection.FindOne(context.TODO(), bson.M{"user_id": userID}).Decode(&prefs)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return defaultNotificationPreferences(userID), nil
+	}
+	if err != nil {
+		return models.NotificationPreferences{}, fmt.Errorf("failed to load notification preferences: %w", err)
+	}
+	return prefs, nil
+}
+
+// UpdateNotificationPreferences replaces a user's notification preferences
+func UpdateNotificationPreferences(userID string, prefs models.NotificationPreferences) (models.NotificationPreferences, error) {
+	if prefs.WebhookURL != "" {
+		if err := validateWebhookURL(prefs.WebhookURL); err != nil {
+			return models.NotificationPreferences{}, fmt.Errorf("invalid webhook_url: %w", err)
+		}
+	}
+
+	prefs.UserID = userID
+	prefs.UpdatedAt = time.Now()
+
+	collection := db.Collection("notification_preferences")
+	_, err := collection.ReplaceOne(context.TODO(), bson.M{"user_id": userID}, prefs, options.Replace().SetUpsert(true))
+	if err != nil {
+		return models.NotificationPreferences{}, fmt.Errorf("failed to save notification preferences: %w", err)
+	}
+	return prefs, nil
+}
+
+// ListNotifications returns a user's inbox, newest first
+func ListNotifications(userID string, unreadOnly bool, limit int) ([]models.Notification, error) {
+	if limit <= 0 || limit > MaxPageSize {
+		limit = DefaultPageSize
+	}
+
+	filter := bson.M{"user_id": userID}
+	if unreadOnly {
+		filter["read"] = false
+	}
+
+	collection := db.Collection("notifications")
+	cursor, err := collection.Find(context.TODO(), filter,
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve notifications: %w", err)
+	}
+	defer cursor.Close(context.TODO())
+
+	notifications := []models.Notification{}
+	if err = cursor.All(context.TODO(), &notifications); err != nil {
+		return nil, fmt.Errorf("error decoding notifications: %w", err)
+	}
+	return notifications, nil
+}
+
+// MarkNotificationsRead marks the given notifications, or all of them when none are given, as read
+func MarkNotificationsRead(userID string, ids []string) (int64, error) {
+	filter := bson.M{"user_id": userID, "read": false}
+	if len(ids) > 0 {
+		objIDs := make([]primitive.ObjectID, 0, len(ids))
+		for _, id := range ids {
+			objID, err := primitive.ObjectIDFromHex(id)
+			if err != nil {
+				return 0, fmt.Errorf("invalid notification ID %q", id)
+			}
+			objIDs = append(objIDs, objID)
+		}
+		filter["_id"] = bson.M{"$in": objIDs}
+	}
+
+	collection := db.Collection("notifications")
+	result, err := collection.UpdateMany(context.TODO(), filter, bson.M{"$set": bson.M{"read": true}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to update notifications: %w", err)
+	}
+	return result.ModifiedCount, nil
+}
+
+// wantsNotification reports whether the preferences opt in to a notification type
+func wantsNotification(prefs models.NotificationPreferences, notificationType string) bool {
+	switch notificationType {
+	case models.NotificationFileDownloaded:
+		return prefs.OnDownload
+	case models.NotificationLinkConsumed:
+		return prefs.OnOneTimeConsumed
+	case models.NotificationLinkExpiring:
+		return prefs.OnLinkExpiring
+	}
+	return false
+}
+
+// notifyUser delivers a notification through every channel the user enabled
+func notifyUser(n models.Notification) {
+	prefs, err := GetNotificationPreferences(n.UserID)
+	if err != nil {
+		log.Printf("Notification for %s dropped: %v", n.UserID, err)
+		return
+	}
+	if !wantsNotification(prefs, n.Type) {
+		return
+	}
+
+	n.ID = primitive.NewObjectID()
+	n.CreatedAt = time.Now()
+
+	if prefs.InApp {
+		collection := db.Collection("notifications")
+		if _, err := collection.InsertOne(context.TODO(), n); err != nil {
+			log.Printf("Failed to store notification for %s: %v", n.UserID, err)
+		}
+	}
+
+	if prefs.Email {
+		if user, err := findUserByID(n.UserID); err != nil {
+			log.Printf("Notification email for %s skipped: %v", n.UserID, err)
+		} else if err := mailer.Send(user.Email, n.Title, n.Message+"\n"); err != nil {
+			log.Printf("Notification email for %s failed: %v", n.UserID, err)
+		}
+	}
+
+	if prefs.WebhookURL != "" {
+		if err := postNotificationWebhook(prefs.WebhookURL, n); err != nil {
+			log.Printf("Notification webhook for %s failed: %v", n.UserID, err)
+		}
+	}
+}
+
+// postNotificationWebhook sends a notification as JSON to the user's webhook,
+// through the same address checks as webhook deliveries
+func postNotificationWebhook(webhookURL string, n models.Notification) error {
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, webhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "SecureShare-Notifier")
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// notificationSubscriber tells a file's owner that one of its share links was
+// used, or that someone else downloaded it directly
+func notificationSubscriber(ctx context.Context, e events.Event) error {
+	switch p := e.Payload.(type) {
+	case events.LinkRedeemed:
+		notifyLinkRedeemed(p.File, p.IP)
+	case events.FileDownloaded:
+		if p.UserID != p.File.Owner {
+			notifyFileDownloaded(p)
+		}
+	}
+	return nil
+}
+
+// notifyFileDownloaded tells a file's owner that a grantee, team member or admin downloaded it
+func notifyFileDownloaded(p events.FileDownloaded) {
+	who := p.UserID
+	if user, err := findUserByID(p.UserID); err == nil {
+		who = user.Email
+	}
+	if p.AdminAccess {
+		who = "an administrator (" + who + ")"
+	}
+	notifyUser(models.Notification{
+		UserID:  p.File.Owner,
+		Type:    models.NotificationFileDownloaded,
+		FileID:  p.File.ID.Hex(),
+		Title:   "File downloaded: " + p.File.Filename,
+		Message: fmt.Sprintf("%q was downloaded by %s.", p.File.Filename, who),
+	})
+}
+
+// notifyLinkRedeemed tells a file's owner that one of its share links was used from ip
+func notifyLinkRedeemed(file models.File, ip string) {
+	n := models.Notification{
+		UserID:  file.Owner,
+		Type:    models.NotificationFileDownloaded,
+		FileID:  file.ID.Hex(),
+		LinkID:  file.LinkID,
+		Title:   "File downloaded: " + file.Filename,
+		Message: fmt.Sprintf("%q was downloaded through a share link from %s.", file.Filename, ip),
+	}
+	if file.TokenType == "one-time" {
+		n.Type = models.NotificationLinkConsumed
+		n.Title = "One-time link used: " + file.Filename
+		n.Message = fmt.Sprintf("The one-time link for %q was used from %s and no longer works.", file.Filename, ip)
+	}
+	notifyUser(n)
+}
+
+// NotifyExpiringLinks warns owners about time-limited share links that expire
+// within the warning period. Each link is warned about once.
+func NotifyExpiringLinks(warning time.Duration) (int, error) {
+	now := time.Now()
+	collection := db.Collection("files")
+
+	cursor, err := collection.Find(context.TODO(), bson.M{
+		"token_type":     "time-limited",
+		"download_token": bson.M{"$exists": true},
+		"token_expires":  bson.M{"$gt": now, "$lte": now.Add(warning)},
+		"deleted_at":     bson.M{"$exists": false},
+		"$expr":          bson.M{"$ne": bson.A{"$link_expiry_notified", "$link_id"}},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to find expiring links: %w", err)
+	}
+	defer cursor.Close(context.TODO())
+
+	var files []models.File
+	if err = cursor.All(context.TODO(), &files); err != nil {
+		return 0, fmt.Errorf("error decoding expiring links: %w", err)
+	}
+
+	notified := 0
+	for _, file := range files {
+		// Claim the warning first so overlapping runs cannot send it twice
+		result, err := collection.UpdateOne(context.TODO(),
+			bson.M{"_id": file.ID, "link_id": file.LinkID, "link_expiry_notified": bson.M{"$ne": file.LinkID}},
+			bson.M{"$set": bson.M{"link_expiry_notified": file.LinkID}})
+		if err != nil || result.ModifiedCount == 0 {
+			continue
+		}
+
+		notifyUser(models.Notification{
+			UserID:  file.Owner,
+			Type:    models.NotificationLinkExpiring,
+			FileID:  file.ID.Hex(),
+			LinkID:  file.LinkID,
+			Title:   "Share link expiring: " + file.Filename,
+			Message: fmt.Sprintf("The share link for %q expires at %s.", file.Filename, file.TokenExpires.UTC().Format(time.RFC1123)),
+		})
+		notified++
+	}
+	return notified, nil
+}
+
+// StartLinkExpiryNotifier runs NotifyExpiringLinks every interval until ctx is cancelled
+func StartLinkExpiryNotifier(ctx context.Context, warning, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		notified, err := NotifyExpiringLinks(warning)
+		if err != nil {
+			log.Printf("Link expiry notification failed: %v", err)
+		} else if notified > 0 {
+			log.Printf("Sent %d link expiry notifications", notified)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
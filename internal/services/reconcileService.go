@@ -0,0 +1,365 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/arzan03/SecureShare/internal/db"
+	"github.com/arzan03/SecureShare/internal/models"
+	"github.com/arzan03/SecureShare/internal/storage"
+	"github.com/arzan03/SecureShare/internal/utils"
+	"github.com/minio/minio-go/v7"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	reconcileBatchSize   = 1000
+	reconcileStatWorkers = 10
+	// Uploads write the object and the record concurrently, so anything younger
+	// than this may still be in flight and is left alone
+	reconcileGracePeriod = time.Hour
+	// Reports list at most this many orphans of each kind; the counts are always complete
+	maxReportedOrphans = 1000
+)
+
+// ErrReconcileRunning is returned when a reconciliation is already in progress
+var ErrReconcileRunning = errors.New("a storage reconciliation is already running")
+
+// OrphanObject is a bucket object that no file record points to
+type OrphanObject struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// OrphanRecord is a file record whose object is missing from the bucket
+type OrphanRecord struct {
+	FileID    string    `json:"file_id"`
+	Filename  string    `json:"filename"`
+	Owner     string    `json:"owner"`
+	ObjectKey string    `json:"object_key"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReconcileReport is the outcome of comparing the bucket with the files collection
+type ReconcileReport struct {
+	Repair          bool           `json:"repair"`
+	StartedAt       time.Time      `json:"started_at"`
+	FinishedAt      time.Time      `json:"finished_at"`
+	ObjectsScanned  int64          `json:"objects_scanned"`
+	RecordsScanned  int64          `json:"records_scanned"`
+	OrphanObjects   int64          `json:"orphan_objects"`
+	OrphanRecords   int64          `json:"orphan_records"`
+	ObjectsRemoved  int64          `json:"objects_removed"`
+	RecordsRemoved  int64          `json:"records_removed"`
+	Errors          int64          `json:"errors"` // Objects or records that could not be checked or repaired
+	Objects         []OrphanObject `json:"objects"`
+	Records         []OrphanRecord `json:"records"`
+	ReportTruncated bool           `json:"report_truncated"`
+}
+
+// ReconcileStatus describes the running reconciliation and the outcome of the last one
+type ReconcileStatus struct {
+	Running   bool             `json:"running"`
+	Progress  *ReconcileReport `json:"progress,omitempty"`   // Counts so far of the running reconciliation
+	Last      *ReconcileReport `json:"last,omitempty"`       // Most recent completed reconciliation
+	LastError string           `json:"last_error,omitempty"` // Why the most recent run failed, if it did
+}
+
+var (
+	reconcileMu      sync.Mutex // Held while a reconciliation runs
+	reconcileStateMu sync.Mutex
+	reconcileState   ReconcileStatus
+)
+
+// GetReconcileStatus reports the running reconciliation, if any, and the last
+// outcome. ok is false when none has run since the server started.
+func GetReconcileStatus() (status ReconcileStatus, ok bool) {
+	reconcileStateMu.Lock()
+	defer reconcileStateMu.Unlock()
+	return reconcileState, reconcileState.Running || reconcileState.Last != nil || reconcileState.LastError != ""
+}
+
+// setReconcileProgress publishes a copy of the running reconciliation's report
+func setReconcileProgress(report *ReconcileReport) {
+	progress := *report
+	progress.Objects = slices.Clone(report.Objects)
+	progress.Records = slices.Clone(report.Records)
+
+	reconcileStateMu.Lock()
+	reconcileState.Running = true
+	reconcileState.Progress = &progress
+	reconcileStateMu.Unlock()
+}
+
+// StartReconcile runs ReconcileStorage in the background and returns at once;
+// GetReconcileStatus reports its progress and result
+func StartReconcile(actorID string, repair bool) error {
+	if !reconcileMu.TryLock() {
+		return ErrReconcileRunning
+	}
+	runBackground(func(ctx context.Context) {
+		defer reconcileMu.Unlock()
+		if _, err := reconcileStorage(ctx, actorID, repair); err != nil {
+			log.Printf("Storage reconciliation failed: %v", err)
+		}
+	})
+	return nil
+}
+
+// ReconcileStorage compares every bucket object with the files collection in
+// batches. With repair set, orphan objects are removed from the bucket and
+// records whose object is missing are deleted. actorID is the admin who asked
+// for it, empty for the background job.
+func ReconcileStorage(ctx context.Context, actorID string, repair bool) (ReconcileReport, error) {
+	if !reconcileMu.TryLock() {
+		return ReconcileReport{}, ErrReconcileRunning
+	}
+	defer reconcileMu.Unlock()
+	return reconcileStorage(ctx, actorID, repair)
+}
+
+// reconcileStorage runs a reconciliation; the caller holds reconcileMu
+func reconcileStorage(ctx context.Context, actorID string, repair bool) (ReconcileReport, error) {
+	report := ReconcileReport{
+		Repair:    repair,
+		StartedAt: time.Now(),
+		Objects:   []OrphanObject{},
+		Records:   []OrphanRecord{},
+	}
+	cutoff := report.StartedAt.Add(-reconcileGracePeriod)
+	setReconcileProgress(&report)
+
+	err := reconcileObjects(ctx, cutoff, &report)
+	if err == nil {
+		err = reconcileRecords(ctx, actorID, cutoff, &report)
+	}
+
+	reconcileStateMu.Lock()
+	defer reconcileStateMu.Unlock()
+	reconcileState.Running = false
+	reconcileState.Progress = nil
+	if err != nil {
+		reconcileState.LastError = err.Error()
+		return ReconcileReport{}, err
+	}
+	report.FinishedAt = time.Now()
+	reconcileState.Last = &report
+	reconcileState.LastError = ""
+	return report, nil
+}
+
+// legacyObjectID returns the file ID of a legacy "<fileID>_<filename>" object key
+func legacyObjectID(key string) (primitive.ObjectID, bool) {
+	if len(key) < 26 || key[24] != '_' {
+		return primitive.ObjectID{}, false
+	}
+	id, err := primitive.ObjectIDFromHex(key[:24])
+	return id, err == nil
+}
+
+// reconcileObjects walks the bucket and finds objects that no record points to
+func reconcileObjects(ctx context.Context, cutoff time.Time, report *ReconcileReport) error {
+	batch := make([]minio.ObjectInfo, 0, reconcileBatchSize)
+	for object := range storage.MinioClient.ListObjects(ctx, storage.Bucket, minio.ListObjectsOptions{Recursive: true}) {
+		if object.Err != nil {
+			return fmt.Errorf("failed to list bucket: %w", object.Err)
+		}
+		report.ObjectsScanned++
+		if object.LastModified.After(cutoff) {
+			continue
+		}
+		batch = append(batch, object)
+		if len(batch) == reconcileBatchSize {
+			if err := reconcileObjectBatch(ctx, batch, report); err != nil {
+				return err
+			}
+			batch = batch[:0]
+			setReconcileProgress(report)
+		}
+	}
+	if len(batch) > 0 {
+		return reconcileObjectBatch(ctx, batch, report)
+	}
+	return nil
+}
+
+// reconcileObjectBatch looks up the records of a batch of objects and handles the orphans
+func reconcileObjectBatch(ctx context.Context, batch []minio.ObjectInfo, report *ReconcileReport) error {
+	keys := make([]string, 0, len(batch))
+	legacyIDs := []primitive.ObjectID{}
+	for _, object := range batch {
+		keys = append(keys, object.Key)
+		if id, ok := legacyObjectID(object.Key); ok {
+			legacyIDs = append(legacyIDs, id)
+		}
+	}
+
+	query := bson.M{"object_key": bson.M{"$in": keys}}
+	if len(legacyIDs) > 0 {
+		query = bson.M{"$or": bson.A{
+			query,
+			bson.M{"_id": bson.M{"$in": legacyIDs}, "object_key": bson.M{"$exists": false}},
+		}}
+	}
+
+	collection := db.Collection("files")
+	cursor, err := collection.Find(ctx, query,
+		options.Find().SetProjection(bson.M{"_id": 1, "object_key": 1, "filename": 1}))
+	if err != nil {
+		return fmt.Errorf("failed to look up file records: %w", err)
+	}
+	var files []models.File
+	if err = cursor.All(ctx, &files); err != nil {
+		return fmt.Errorf("error decoding file records: %w", err)
+	}
+
+	referenced := make(map[string]bool, len(files))
+	for _, file := range files {
+		referenced[objectKey(file)] = true
+	}
+
+	for _, object := range batch {
+		if referenced[object.Key] {
+			continue
+		}
+		report.OrphanObjects++
+		if len(report.Objects) < maxReportedOrphans {
+			report.Objects = append(report.Objects, OrphanObject{Key: object.Key, Size: object.Size, LastModified: object.LastModified})
+		} else {
+			report.ReportTruncated = true
+		}
+
+		if report.Repair {
+			if err := storage.MinioClient.RemoveObject(ctx, storage.Bucket, object.Key, minio.RemoveObjectOptions{}); err != nil {
+				log.Printf("Reconciliation failed to remove orphan object %s: %v", object.Key, err)
+				report.Errors++
+				continue
+			}
+			report.ObjectsRemoved++
+		}
+	}
+	return nil
+}
+
+// reconcileRecords walks the files collection and finds records whose object is missing
+func reconcileRecords(ctx context.Context, actorID string, cutoff time.Time, report *ReconcileReport) error {
+	collection := db.Collection("files")
+	cursor, err := collection.Find(ctx, bson.M{"created_at": bson.M{"$lte": cutoff}},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetBatchSize(reconcileBatchSize))
+	if err != nil {
+		return fmt.Errorf("failed to scan file records: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	batch := make([]models.File, 0, reconcileBatchSize)
+	for cursor.Next(ctx) {
+		var file models.File
+		if err := cursor.Decode(&file); err != nil {
+			report.Errors++
+			continue
+		}
+		report.RecordsScanned++
+		batch = append(batch, file)
+		if len(batch) == reconcileBatchSize {
+			reconcileRecordBatch(ctx, actorID, batch, report)
+			batch = batch[:0]
+			setReconcileProgress(report)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to scan file records: %w", err)
+	}
+	if len(batch) > 0 {
+		reconcileRecordBatch(ctx, actorID, batch, report)
+	}
+	return nil
+}
+
+// reconcileRecordBatch checks the objects of a batch of records concurrently and handles the orphans
+func reconcileRecordBatch(ctx context.Context, actorID string, batch []models.File, report *ReconcileReport) {
+	missing := make([]bool, len(batch))
+	var failed int64
+	var mu sync.Mutex
+
+	pool := utils.NewWorkerPool(reconcileStatWorkers)
+	for i := range batch {
+		i := i
+		pool.AddTask(func() {
+			_, err := storage.MinioClient.StatObject(ctx, storage.Bucket, objectKey(batch[i]), minio.StatObjectOptions{})
+			if err == nil {
+				return
+			}
+			if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+				missing[i] = true
+				return
+			}
+			// Only a definite "not found" counts as an orphan
+			mu.Lock()
+			failed++
+			mu.Unlock()
+		})
+	}
+	pool.Wait()
+	pool.Close()
+	report.Errors += failed
+
+	for i, file := range batch {
+		if !missing[i] {
+			continue
+		}
+		report.OrphanRecords++
+		if len(report.Records) < maxReportedOrphans {
+			report.Records = append(report.Records, OrphanRecord{
+				FileID:    file.ID.Hex(),
+				Filename:  file.Filename,
+				Owner:     file.Owner,
+				ObjectKey: objectKey(file),
+				CreatedAt: file.CreatedAt,
+			})
+		} else {
+			report.ReportTruncated = true
+		}
+
+		if report.Repair {
+			if err := removeFileParallel(context.TODO(), file, actorID); err != nil {
+				log.Printf("Reconciliation failed to remove orphan record %s: %v", file.ID.Hex(), err)
+				report.Errors++
+				continue
+			}
+			report.RecordsRemoved++
+		}
+	}
+}
+
+// StartStorageReconciler runs ReconcileStorage every interval until ctx is cancelled.
+// The first run waits a full interval so restarts do not rescan the bucket.
+func StartStorageReconciler(ctx context.Context, repair bool, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		report, err := ReconcileStorage(ctx, "", repair)
+		if err != nil {
+			log.Printf("Storage reconciliation failed: %v", err)
+			continue
+		}
+		if report.OrphanObjects > 0 || report.OrphanRecords > 0 || report.Errors > 0 {
+			log.Printf("Storage reconciliation: %d orphan objects (%d removed), %d orphan records (%d removed), %d errors",
+				report.OrphanObjects, report.ObjectsRemoved, report.OrphanRecords, report.RecordsRemoved, report.Errors)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/arzan03/SecureShare/internal/db"
+	"github.com/arzan03/SecureShare/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SearchResult is a file matched by a search along with its relevance score
+type SearchResult struct {
+	models.File `bson:",inline"`
+	Score       float64 `bson:"score" json:"score"`
+}
+
+// SearchFiles searches filenames, tags and descriptions of the files matching base.
+// Text index matches come first ordered by relevance, followed by files whose name
+// or tags merely start with the last search term so partially typed words still match.
+func SearchFiles(base bson.M, query string, limit int64) ([]SearchResult, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, errors.New("search query is required")
+	}
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	collection := db.Collection("files")
+
+	textQuery := bson.M{"$text": bson.M{"$search": query}}
+	for k, v := range base {
+		textQuery[k] = v
+	}
+
+	findOpts := options.Find().
+		SetProjection(bson.M{"score": bson.M{"$meta": "textScore"}}).
+		SetSort(bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}}).
+		SetLimit(limit)
+
+	cursor, err := collection.Find(context.TODO(), textQuery, findOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search files: %w", err)
+	}
+	results := []SearchResult{}
+	err = cursor.All(context.TODO(), &results)
+	cursor.Close(context.TODO())
+	if err != nil {
+		return nil, fmt.Errorf("error decoding search results: %w", err)
+	}
+
+	if int64(len(results)) >= limit {
+		return results, nil
+	}
+
+	// Top up with prefix matches on the last term, skipping files already found
+	terms := strings.Fields(query)
+	prefix := regexp.QuoteMeta(terms[len(terms)-1])
+	seen := make([]primitive.ObjectID, 0, len(results))
+	for _, r := range results {
+		seen = append(seen, r.ID)
+	}
+
+	prefixQuery := bson.M{
+		"_id": bson.M{"$nin": seen},
+		"$or": bson.A{
+			// Match the start of any word in the filename, e.g. "rep" finds "q3_report.pdf"
+			bson.M{"filename": bson.M{"$regex": `(^|[\s_.\-])` + prefix, "$options": "i"}},
+			bson.M{"tags": bson.M{"$regex": "^" + prefix, "$options": "i"}},
+		},
+	}
+	for k, v := range base {
+		prefixQuery[k] = v
+	}
+
+	cursor, err = collection.Find(context.TODO(), prefixQuery, options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetLimit(limit-int64(len(results))))
+	if err != nil {
+		return nil, fmt.Errorf("failed to search files: %w", err)
+	}
+	defer cursor.Close(context.TODO())
+
+	var prefixResults []SearchResult
+	if err = cursor.All(context.TODO(), &prefixResults); err != nil {
+		return nil, fmt.Errorf("error decoding search results: %w", err)
+	}
+
+	return append(results, prefixResults...), nil
+}
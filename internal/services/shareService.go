@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/arzan03/SecureShare/internal/db"
+	"github.com/arzan03/SecureShare/internal/events"
+	"github.com/arzan03/SecureShare/internal/models"
+	"github.com/arzan03/SecureShare/internal/storage"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ShareFile grants another user viewer or editor access to a file.
+// Sharing again with the same user replaces their role.
+func ShareFile(ctx context.Context, fileID, ownerID, email, role string) (models.FileShare, error) {
+	if role != ShareRoleViewer && role != ShareRoleEditor {
+		return models.FileShare{}, errors.New("role must be viewer or editor")
+	}
+
+	file, err := loadFile(fileID, ownerID, AccessOwner)
+	if err != nil {
+		return models.FileShare{}, err
+	}
+
+	recipient, err := FindUserByEmail(email)
+	if err != nil {
+		return models.FileShare{}, errors.New("recipient not found")
+	}
+	if recipient.ID.Hex() == ownerID {
+		return models.FileShare{}, errors.New("cannot share a file with its owner")
+	}
+
+	share := models.FileShare{
+		UserID:    recipient.ID.Hex(),
+		Email:     recipient.Email,
+		Role:      role,
+		GrantedAt: time.Now(),
+	}
+
+	// Replace the recipient's grant in a single update pipeline, so concurrent
+	// grants and revocations of other users are never overwritten
+	collection := db.Collection("files")
+	_, err = collection.UpdateOne(context.TODO(), bson.M{"_id": file.ID}, bson.A{
+		bson.M{"$set": bson.M{"shares": bson.M{"$concatArrays": bson.A{
+			bson.A{share},
+			bson.M{"$filter": bson.M{
+				"input": bson.M{"$ifNull": bson.A{"$shares", bson.A{}}},
+				"cond":  bson.M{"$ne": bson.A{"$$this.user_id", share.UserID}},
+			}},
+		}}}},
+	})
+	if err != nil {
+		return models.FileShare{}, fmt.Errorf("failed to share file: %w", err)
+	}
+
+	publish(ctx, events.FileShared{File: eventFile(file), ActorID: ownerID, Share: share})
+	return share, nil
+}
+
+// ListShares returns the access grants on a file
+func ListShares(fileID, ownerID string) ([]models.FileShare, error) {
+	file, err := loadFile(fileID, ownerID, AccessOwner)
+	if err != nil {
+		return nil, err
+	}
+	if file.Shares == nil {
+		return []models.FileShare{}, nil
+	}
+	return file.Shares, nil
+}
+
+// RevokeShare removes a user's access grant from a file
+func RevokeShare(ctx context.Context, fileID, ownerID, targetUserID string) error {
+	file, err := loadFile(fileID, ownerID, AccessOwner)
+	if err != nil {
+		return err
+	}
+
+	collection := db.Collection("files")
+	result, err := collection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": file.ID, "shares.user_id": targetUserID},
+		bson.M{"$pull": bson.M{"shares": bson.M{"user_id": targetUserID}}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke access: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("file is not shared with this user")
+	}
+
+	publish(ctx, events.ShareRevoked{File: eventFile(file), ActorID: ownerID, UserID: targetUserID})
+	return nil
+}
+
+// ListSharedWithMe returns one page of files other users have shared with the user
+func ListSharedWithMe(userID string, opts FileListOptions) (FilePage, error) {
+	page, err := ListFiles(bson.M{"shares.user_id": userID, "deleted_at": bson.M{"$exists": false}}, opts)
+	if err != nil {
+		return FilePage{}, err
+	}
+	for i, file := range page.Files {
+		page.Files[i] = viewFor(file, userID, fileTeamRole(file, userID))
+	}
+	return page, nil
+}
+
+// GetDownloadURL returns a short-lived MinIO link for a file the user can view,
+// letting owners and grantees download without a share token.
+func GetDownloadURL(ctx context.Context, fileID, userID string) (string, error) {
+	file, err := loadFile(fileID, userID, AccessView)
+	if err != nil {
+		return "", err
+	}
+	return presignDownload(ctx, file, userID, false)
+}
+
+// AdminGetDownloadURL returns a short-lived download link for any file, for support cases
+func AdminGetDownloadURL(fileID, adminID string) (string, error) {
+	file, err := loadFileAsAdmin(fileID)
+	if err != nil {
+		return "", err
+	}
+	return presignDownload(context.TODO(), file, adminID, true)
+}
+
+// presignDownload signs a 10 minute download URL for a loaded file and records the download
+func presignDownload(ctx context.Context, file models.File, userID string, byAdmin bool) (string, error) {
+	url, err := storage.MinioClient.PresignedGetObject(context.Background(), storage.Bucket, objectKey(file), 10*time.Minute, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate download link: %w", err)
+	}
+
+	publish(ctx, events.FileDownloaded{File: eventFile(file), UserID: userID, AdminAccess: byAdmin})
+	return url.String(), nil
+}
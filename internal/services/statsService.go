@@ -0,0 +1,268 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/arzan03/SecureShare/internal/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	statsCacheTTL     = time.Minute
+	defaultStatsTop   = 10
+	defaultStatsDays  = 30
+	maxStatsDays      = 365
+	statsExpiryWindow = 7 * 24 * time.Hour
+)
+
+// StatsQuery sizes the rankings and the upload history of the system statistics
+type StatsQuery struct {
+	Top  int // Entries in the user and download rankings
+	Days int // Days of upload history
+}
+
+// StorageTotals counts files and bytes
+type StorageTotals struct {
+	Files int64 `bson:"files" json:"files"`
+	Bytes int64 `bson:"bytes" json:"bytes"`
+}
+
+// UserUsage is one user's share of the storage
+type UserUsage struct {
+	UserID string `bson:"_id" json:"user_id"`
+	Email  string `bson:"email" json:"email,omitempty"`
+	Files  int64  `bson:"files" json:"files"`
+	Bytes  int64  `bson:"bytes" json:"bytes"`
+}
+
+// DailyUploads counts the uploads of one day
+type DailyUploads struct {
+	Day   time.Time `bson:"_id" json:"day"`
+	Files int64     `bson:"files" json:"files"`
+	Bytes int64     `bson:"bytes" json:"bytes"`
+}
+
+// FileDownloads is a file ranked by successful share link downloads
+type FileDownloads struct {
+	FileID    string `bson:"_id" json:"file_id"`
+	Filename  string `bson:"filename" json:"filename,omitempty"` // Empty once the file is deleted
+	Owner     string `bson:"owner" json:"owner"`
+	Downloads int64  `bson:"downloads" json:"downloads"`
+}
+
+// SystemStats is the admin dashboard overview
+type SystemStats struct {
+	Users         int64            `json:"users"`
+	Storage       StorageTotals    `json:"storage"` // Live files
+	Trash         StorageTotals    `json:"trash"`
+	TopUsers      []UserUsage      `json:"top_users"`
+	UploadsPerDay []DailyUploads   `json:"uploads_per_day"`
+	ActiveLinks   map[string]int64 `json:"active_links"`   // By token type
+	ExpiringFiles int64            `json:"expiring_files"` // Files expiring within the next 7 days
+	TopDownloads  []FileDownloads  `json:"top_downloads"`
+	GeneratedAt   time.Time        `json:"generated_at"`
+}
+
+type cachedStats struct {
+	stats   SystemStats
+	expires time.Time
+}
+
+// statsCache keeps recent results per query; the aggregations scan whole collections
+var (
+	statsCacheMu sync.Mutex
+	statsCache   = map[StatsQuery]cachedStats{}
+)
+
+// GetSystemStats returns the dashboard statistics, recomputed at most once a minute per query
+func GetSystemStats(q StatsQuery) (SystemStats, error) {
+	if q.Top <= 0 || q.Top > MaxPageSize {
+		q.Top = defaultStatsTop
+	}
+	if q.Days <= 0 || q.Days > maxStatsDays {
+		q.Days = defaultStatsDays
+	}
+
+	statsCacheMu.Lock()
+	cached, ok := statsCache[q]
+	statsCacheMu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.stats, nil
+	}
+
+	stats, err := computeSystemStats(q)
+	if err != nil {
+		return SystemStats{}, err
+	}
+
+	statsCacheMu.Lock()
+	statsCache[q] = cachedStats{stats: stats, expires: time.Now().Add(statsCacheTTL)}
+	statsCacheMu.Unlock()
+	return stats, nil
+}
+
+func computeSystemStats(q StatsQuery) (SystemStats, error) {
+	ctx := context.TODO()
+	now := time.Now()
+	stats := SystemStats{GeneratedAt: now}
+
+	users, err := db.Collection("users").EstimatedDocumentCount(ctx)
+	if err != nil {
+		return SystemStats{}, fmt.Errorf("failed to count users: %w", err)
+	}
+	stats.Users = users
+
+	if err := fileStats(ctx, q, now, &stats); err != nil {
+		return SystemStats{}, err
+	}
+
+	if stats.TopDownloads, err = topDownloads(ctx, q.Top); err != nil {
+		return SystemStats{}, err
+	}
+	return stats, nil
+}
+
+// fileStats fills in everything computed from the files collection in a single $facet aggregation
+func fileStats(ctx context.Context, q StatsQuery, now time.Time, stats *SystemStats) error {
+	live := bson.M{"deleted_at": bson.M{"$exists": false}}
+	totals := bson.M{"$group": bson.M{"_id": nil, "files": bson.M{"$sum": 1}, "bytes": bson.M{"$sum": "$size"}}}
+	since := now.AddDate(0, 0, -q.Days).Truncate(24 * time.Hour)
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$facet", Value: bson.M{
+			"storage": bson.A{bson.M{"$match": live}, totals},
+			"trash":   bson.A{bson.M{"$match": bson.M{"deleted_at": bson.M{"$exists": true}}}, totals},
+			"top_users": bson.A{
+				bson.M{"$group": bson.M{"_id": "$owner", "files": bson.M{"$sum": 1}, "bytes": bson.M{"$sum": "$size"}}},
+				bson.M{"$sort": bson.D{{Key: "bytes", Value: -1}, {Key: "_id", Value: 1}}},
+				bson.M{"$limit": q.Top},
+				// Owners are stored as hex strings; tolerate any that are not valid IDs
+				bson.M{"$lookup": bson.M{
+					"from": "users",
+					"let":  bson.M{"owner": bson.M{"$convert": bson.M{"input": "$_id", "to": "objectId", "onError": nil, "onNull": nil}}},
+					"pipeline": bson.A{
+						bson.M{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$_id", "$$owner"}}}},
+						bson.M{"$project": bson.M{"email": 1}},
+					},
+					"as": "user",
+				}},
+				bson.M{"$set": bson.M{"email": bson.M{"$first": "$user.email"}}},
+				bson.M{"$unset": "user"},
+			},
+			"uploads_per_day": bson.A{
+				bson.M{"$match": bson.M{"created_at": bson.M{"$gte": since}}},
+				bson.M{"$group": bson.M{
+					"_id":   bson.M{"$dateTrunc": bson.M{"date": "$created_at", "unit": "day"}},
+					"files": bson.M{"$sum": 1},
+					"bytes": bson.M{"$sum": "$size"},
+				}},
+				bson.M{"$sort": bson.M{"_id": 1}},
+			},
+			"active_links": bson.A{
+				bson.M{"$match": bson.M{
+					"download_token": bson.M{"$exists": true},
+					"deleted_at":     bson.M{"$exists": false},
+					"$or": bson.A{
+						bson.M{"token_type": "one-time"},
+						bson.M{"token_expires": bson.M{"$gt": now}},
+					},
+				}},
+				bson.M{"$group": bson.M{"_id": "$token_type", "count": bson.M{"$sum": 1}}},
+			},
+			"expiring": bson.A{
+				bson.M{"$match": bson.M{
+					"deleted_at": bson.M{"$exists": false},
+					"expires_at": bson.M{"$gt": now, "$lte": now.Add(statsExpiryWindow)},
+				}},
+				bson.M{"$count": "count"},
+			},
+		}}},
+	}
+
+	cursor, err := db.Collection("files").Aggregate(ctx, pipeline)
+	if err != nil {
+		return fmt.Errorf("failed to compute file statistics: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var facets []struct {
+		Storage       []StorageTotals `bson:"storage"`
+		Trash         []StorageTotals `bson:"trash"`
+		TopUsers      []UserUsage     `bson:"top_users"`
+		UploadsPerDay []DailyUploads  `bson:"uploads_per_day"`
+		ActiveLinks   []struct {
+			Type  string `bson:"_id"`
+			Count int64  `bson:"count"`
+		} `bson:"active_links"`
+		Expiring []struct {
+			Count int64 `bson:"count"`
+		} `bson:"expiring"`
+	}
+	if err := cursor.All(ctx, &facets); err != nil {
+		return fmt.Errorf("error decoding file statistics: %w", err)
+	}
+
+	stats.TopUsers = []UserUsage{}
+	stats.UploadsPerDay = []DailyUploads{}
+	stats.ActiveLinks = map[string]int64{}
+	if len(facets) == 0 {
+		return nil
+	}
+	f := facets[0]
+	if len(f.Storage) > 0 {
+		stats.Storage = f.Storage[0]
+	}
+	if len(f.Trash) > 0 {
+		stats.Trash = f.Trash[0]
+	}
+	if f.TopUsers != nil {
+		stats.TopUsers = f.TopUsers
+	}
+	if f.UploadsPerDay != nil {
+		stats.UploadsPerDay = f.UploadsPerDay
+	}
+	for _, l := range f.ActiveLinks {
+		stats.ActiveLinks[l.Type] = l.Count
+	}
+	if len(f.Expiring) > 0 {
+		stats.ExpiringFiles = f.Expiring[0].Count
+	}
+	return nil
+}
+
+// topDownloads ranks files by successful share link downloads in the access log
+func topDownloads(ctx context.Context, top int) ([]FileDownloads, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"success": true}}},
+		{{Key: "$group", Value: bson.M{"_id": "$file_id", "owner": bson.M{"$first": "$owner"}, "downloads": bson.M{"$sum": 1}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "downloads", Value: -1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$limit", Value: top}},
+		{{Key: "$lookup", Value: bson.M{
+			"from": "files",
+			"let":  bson.M{"file": bson.M{"$convert": bson.M{"input": "$_id", "to": "objectId", "onError": nil, "onNull": nil}}},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$_id", "$$file"}}}},
+				bson.M{"$project": bson.M{"filename": 1}},
+			},
+			"as": "file",
+		}}},
+		{{Key: "$set", Value: bson.M{"filename": bson.M{"$first": "$file.filename"}}}},
+		{{Key: "$unset", Value: "file"}},
+	}
+
+	cursor, err := db.Collection("access_logs").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rank downloads: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	downloads := []FileDownloads{}
+	if err := cursor.All(ctx, &downloads); err != nil {
+		return nil, fmt.Errorf("error decoding download ranking: %w", err)
+	}
+	return downloads, nil
+}
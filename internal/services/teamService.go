@@ -0,0 +1,497 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arzan03/SecureShare/internal/db"
+	"github.com/arzan03/SecureShare/internal/events"
+	"github.com/arzan03/SecureShare/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Team roles, from most to least privileged
+const (
+	TeamRoleOwner  = "owner"
+	TeamRoleAdmin  = "admin"
+	TeamRoleMember = "member"
+	TeamRoleViewer = "viewer"
+)
+
+var (
+	ErrTeamNotFound      = errors.New("team not found")
+	ErrTeamQuotaExceeded = errors.New("team storage quota exceeded")
+	ErrLastTeamOwner     = errors.New("a team must keep at least one owner")
+	ErrTeamChanged       = errors.New("team membership changed concurrently; try again")
+)
+
+// teamUpdateAttempts bounds how often a membership change is re-checked
+// against a team that others modified in the meantime
+const teamUpdateAttempts = 3
+
+// teamRoleRanks orders team roles so they can be compared
+var teamRoleRanks = map[string]int{
+	TeamRoleViewer: 1,
+	TeamRoleMember: 2,
+	TeamRoleAdmin:  3,
+	TeamRoleOwner:  4,
+}
+
+// TeamRoleRank returns the rank of a team role, 0 for unknown roles
+func TeamRoleRank(role string) int {
+	return teamRoleRanks[role]
+}
+
+// TeamUsage is a team with its current storage consumption
+type TeamUsage struct {
+	models.Team
+	UsedBytes int64 `json:"used_bytes"`
+	FileCount int64 `json:"file_count"`
+}
+
+// findTeam loads a team by ID
+func findTeam(teamID string) (models.Team, error) {
+	objID, err := primitive.ObjectIDFromHex(teamID)
+	if err != nil {
+		return models.Team{}, ErrTeamNotFound
+	}
+
+	collection := db.Collection("teams")
+	var team models.Team
+	if err := collection.FindOne(context.TODO(), bson.M{"_id": objID}).Decode(&team); err != nil {
+		return models.Team{}, ErrTeamNotFound
+	}
+	return team, nil
+}
+
+// memberRole returns the user's role in the team, or "" if they are not a member
+func memberRole(team models.Team, userID string) string {
+	for _, m := range team.Members {
+		if m.UserID == userID {
+			return m.Role
+		}
+	}
+	return ""
+}
+
+// teamRoleOf looks up the user's role in a team, or "" if they are not a member
+func teamRoleOf(teamID, userID string) string {
+	team, err := findTeam(teamID)
+	if err != nil {
+		return ""
+	}
+	return memberRole(team, userID)
+}
+
+// RequireTeamRole loads a team and checks the user holds at least minRole in it.
+// Non-members get ErrTeamNotFound so the team's existence is not revealed.
+func RequireTeamRole(teamID, userID, minRole string) (models.Team, error) {
+	team, err := findTeam(teamID)
+	if err != nil {
+		return models.Team{}, err
+	}
+
+	role := memberRole(team, userID)
+	if role == "" {
+		return models.Team{}, ErrTeamNotFound
+	}
+	if TeamRoleRank(role) < TeamRoleRank(minRole) {
+		return models.Team{}, ErrAccessDenied
+	}
+	return team, nil
+}
+
+// CreateTeam creates a team with the creator as its owner
+func CreateTeam(name, userID string) (models.Team, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return models.Team{}, errors.New("team name is required")
+	}
+
+	creator, err := findUserByID(userID)
+	if err != nil {
+		return models.Team{}, errors.New("user not found")
+	}
+
+	now := time.Now()
+	team := models.Team{
+		ID:   primitive.NewObjectID(),
+		Name: name,
+		Members: []models.TeamMember{{
+			UserID:   userID,
+			Email:    creator.Email,
+			Role:     TeamRoleOwner,
+			JoinedAt: now,
+		}},
+		CreatedBy: userID,
+		CreatedAt: now,
+	}
+
+	collection := db.Collection("teams")
+	if _, err := collection.InsertOne(context.TODO(), team); err != nil {
+		return models.Team{}, fmt.Errorf("failed to create team: %w", err)
+	}
+	return team, nil
+}
+
+// ListUserTeams returns the teams a user belongs to
+func ListUserTeams(userID string) ([]models.Team, error) {
+	collection := db.Collection("teams")
+
+	cursor, err := collection.Find(context.TODO(), bson.M{"members.user_id": userID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve teams: %w", err)
+	}
+	defer cursor.Close(context.TODO())
+
+	teams := []models.Team{}
+	if err = cursor.All(context.TODO(), &teams); err != nil {
+		return nil, fmt.Errorf("error decoding teams: %w", err)
+	}
+	return teams, nil
+}
+
+// teamStorageUsed sums the size of every file the team owns, trashed files included
+func teamStorageUsed(teamID string) (int64, int64, error) {
+	collection := db.Collection("files")
+
+	cursor, err := collection.Aggregate(context.TODO(), mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"team_id": teamID}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   nil,
+			"bytes": bson.M{"$sum": "$size"},
+			"count": bson.M{"$sum": 1},
+		}}},
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to compute team usage: %w", err)
+	}
+	defer cursor.Close(context.TODO())
+
+	var totals []struct {
+		Bytes int64 `bson:"bytes"`
+		Count int64 `bson:"count"`
+	}
+	if err = cursor.All(context.TODO(), &totals); err != nil {
+		return 0, 0, fmt.Errorf("failed to compute team usage: %w", err)
+	}
+	if len(totals) == 0 {
+		return 0, 0, nil
+	}
+	return totals[0].Bytes, totals[0].Count, nil
+}
+
+// GetTeamUsage returns a team with its storage usage
+func GetTeamUsage(team models.Team) (TeamUsage, error) {
+	used, count, err := teamStorageUsed(team.ID.Hex())
+	if err != nil {
+		return TeamUsage{}, err
+	}
+	return TeamUsage{Team: team, UsedBytes: used, FileCount: count}, nil
+}
+
+// checkTeamQuota verifies the team can take another size bytes
+func checkTeamQuota(team models.Team, size int64) error {
+	if team.QuotaBytes <= 0 {
+		return nil
+	}
+	used, _, err := teamStorageUsed(team.ID.Hex())
+	if err != nil {
+		return err
+	}
+	if used+size > team.QuotaBytes {
+		return fmt.Errorf("%w: %d of %d bytes used", ErrTeamQuotaExceeded, used, team.QuotaBytes)
+	}
+	return nil
+}
+
+// RenameTeam changes a team's name
+func RenameTeam(teamID, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("team name is required")
+	}
+	return updateTeam(teamID, bson.M{"$set": bson.M{"name": name}})
+}
+
+// SetTeamQuota sets a team's storage quota in bytes, 0 for unlimited
+func SetTeamQuota(teamID string, quotaBytes int64) error {
+	if quotaBytes < 0 {
+		return errors.New("quota cannot be negative")
+	}
+	return updateTeam(teamID, bson.M{"$set": bson.M{"quota_bytes": quotaBytes}})
+}
+
+func updateTeam(teamID string, update bson.M) error {
+	objID, err := primitive.ObjectIDFromHex(teamID)
+	if err != nil {
+		return ErrTeamNotFound
+	}
+
+	collection := db.Collection("teams")
+	result, err := collection.UpdateOne(context.TODO(), bson.M{"_id": objID}, update)
+	if err != nil {
+		return fmt.Errorf("failed to update team: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrTeamNotFound
+	}
+	return nil
+}
+
+// DeleteTeam deletes a team that no longer owns any files
+func DeleteTeam(teamID string) error {
+	_, count, err := teamStorageUsed(teamID)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("team still owns files; delete or transfer them first")
+	}
+
+	objID, err := primitive.ObjectIDFromHex(teamID)
+	if err != nil {
+		return ErrTeamNotFound
+	}
+
+	collection := db.Collection("teams")
+	if _, err := collection.DeleteOne(context.TODO(), bson.M{"_id": objID}); err != nil {
+		return fmt.Errorf("failed to delete team: %w", err)
+	}
+	return nil
+}
+
+// canAssignRole reports whether a member with actorRole may give or take away role.
+// Owners manage everyone; admins manage everyone except owners.
+func canAssignRole(actorRole, role string) bool {
+	if actorRole == TeamRoleOwner {
+		return true
+	}
+	return actorRole == TeamRoleAdmin && role != TeamRoleOwner
+}
+
+// ownerCount counts the owners of a team
+func ownerCount(team models.Team) int {
+	n := 0
+	for _, m := range team.Members {
+		if m.Role == TeamRoleOwner {
+			n++
+		}
+	}
+	return n
+}
+
+// memberIs matches a team in which the user holds role, or is not a member when role is empty
+func memberIs(userID, role string) bson.M {
+	if role == "" {
+		return bson.M{"members.user_id": bson.M{"$ne": userID}}
+	}
+	return bson.M{"members": bson.M{"$elemMatch": bson.M{"user_id": userID, "role": role}}}
+}
+
+// hasOtherOwner matches a team with more than one owner, so one can leave or step down
+var hasOtherOwner = bson.M{"$expr": bson.M{"$gt": bson.A{
+	bson.M{"$size": bson.M{"$filter": bson.M{
+		"input": "$members",
+		"cond":  bson.M{"$eq": bson.A{"$$this.role", TeamRoleOwner}},
+	}}},
+	1,
+}}}
+
+// soleOwnerOf matches a team whose only owner is the user
+func soleOwnerOf(userID string) bson.M {
+	return bson.M{"$and": bson.A{memberIs(userID, TeamRoleOwner), bson.M{"$nor": bson.A{hasOtherOwner}}}}
+}
+
+// updateMembers applies a membership change only if the team still matches
+// every condition the change was checked against
+func updateMembers(teamID primitive.ObjectID, conditions bson.A, update bson.M, opts ...*options.UpdateOptions) error {
+	collection := db.Collection("teams")
+	result, err := collection.UpdateOne(context.TODO(), bson.M{"_id": teamID, "$and": conditions}, update, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to update team: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrTeamChanged
+	}
+	return nil
+}
+
+// retryTeamChange runs a membership change, re-checking it against the current
+// team when a concurrent change got in first
+func retryTeamChange(team models.Team, change func(team models.Team) error) error {
+	for attempt := 1; ; attempt++ {
+		err := change(team)
+		if !errors.Is(err, ErrTeamChanged) || attempt == teamUpdateAttempts {
+			return err
+		}
+		if team, err = findTeam(team.ID.Hex()); err != nil {
+			return err
+		}
+	}
+}
+
+// AddTeamMember adds a user to a team, or changes their role if already a member
+func AddTeamMember(team models.Team, actorID, email, role string) (models.TeamMember, error) {
+	if TeamRoleRank(role) == 0 {
+		return models.TeamMember{}, errors.New("role must be owner, admin, member or viewer")
+	}
+
+	user, err := FindUserByEmail(email)
+	if err != nil {
+		return models.TeamMember{}, errors.New("user not found")
+	}
+
+	return setMemberRole(team, actorID, user.ID.Hex(), user.Email, role)
+}
+
+// UpdateTeamMember changes an existing member's role
+func UpdateTeamMember(team models.Team, actorID, targetID, role string) (models.TeamMember, error) {
+	if TeamRoleRank(role) == 0 {
+		return models.TeamMember{}, errors.New("role must be owner, admin, member or viewer")
+	}
+
+	for _, m := range team.Members {
+		if m.UserID == targetID {
+			return setMemberRole(team, actorID, targetID, m.Email, role)
+		}
+	}
+	return models.TeamMember{}, errors.New("user is not a member of this team")
+}
+
+// setMemberRole adds or updates a member in one atomic update, filtered on the
+// roles the permission and owner checks were made against
+func setMemberRole(team models.Team, actorID, targetID, email, role string) (models.TeamMember, error) {
+	var member models.TeamMember
+	err := retryTeamChange(team, func(team models.Team) error {
+		actorRole := memberRole(team, actorID)
+		currentRole := memberRole(team, targetID)
+
+		if !canAssignRole(actorRole, role) || (currentRole != "" && !canAssignRole(actorRole, currentRole)) {
+			return ErrAccessDenied
+		}
+		if currentRole == TeamRoleOwner && role != TeamRoleOwner && ownerCount(team) == 1 {
+			return ErrLastTeamOwner
+		}
+
+		conditions := bson.A{memberIs(actorID, actorRole), memberIs(targetID, currentRole)}
+		member = models.TeamMember{UserID: targetID, Email: email, Role: role, JoinedAt: time.Now()}
+		if currentRole == "" {
+			return updateMembers(team.ID, conditions, bson.M{"$push": bson.M{"members": member}})
+		}
+
+		for _, m := range team.Members {
+			if m.UserID == targetID {
+				member.JoinedAt = m.JoinedAt
+			}
+		}
+		if currentRole == TeamRoleOwner && role != TeamRoleOwner {
+			conditions = append(conditions, hasOtherOwner)
+		}
+		return updateMembers(team.ID, conditions,
+			bson.M{"$set": bson.M{"members.$[m].role": role}},
+			options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"m.user_id": targetID}}}))
+	})
+	if err != nil {
+		return models.TeamMember{}, err
+	}
+	return member, nil
+}
+
+// RemoveTeamMember removes a user from a team. Members may always remove themselves.
+func RemoveTeamMember(team models.Team, actorID, targetID string) error {
+	return retryTeamChange(team, func(team models.Team) error {
+		actorRole := memberRole(team, actorID)
+		targetRole := memberRole(team, targetID)
+		if targetRole == "" {
+			return errors.New("user is not a member of this team")
+		}
+		if actorID != targetID && !canAssignRole(actorRole, targetRole) {
+			return ErrAccessDenied
+		}
+		if targetRole == TeamRoleOwner && ownerCount(team) == 1 {
+			return ErrLastTeamOwner
+		}
+
+		conditions := bson.A{memberIs(actorID, actorRole), memberIs(targetID, targetRole)}
+		if targetRole == TeamRoleOwner {
+			conditions = append(conditions, hasOtherOwner)
+		}
+		return updateMembers(team.ID, conditions, bson.M{"$pull": bson.M{"members": bson.M{"user_id": targetID}}})
+	})
+}
+
+// ListTeamFiles returns one page of a team's files for a member
+func ListTeamFiles(teamID, userID string, opts FileListOptions) (FilePage, error) {
+	team, err := RequireTeamRole(teamID, userID, TeamRoleViewer)
+	if err != nil {
+		return FilePage{}, err
+	}
+	page, err := ListFiles(bson.M{"team_id": teamID, "deleted_at": bson.M{"$exists": false}}, opts)
+	if err != nil {
+		return FilePage{}, err
+	}
+	for i, file := range page.Files {
+		page.Files[i] = viewFor(file, userID, memberRole(team, userID))
+	}
+	return page, nil
+}
+
+// SearchTeamFiles searches a team's files for a member
+func SearchTeamFiles(teamID, userID, query string, limit int64) ([]SearchResult, error) {
+	team, err := RequireTeamRole(teamID, userID, TeamRoleViewer)
+	if err != nil {
+		return nil, err
+	}
+	results, err := SearchFiles(bson.M{"team_id": teamID, "deleted_at": bson.M{"$exists": false}}, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range results {
+		results[i].File = viewFor(results[i].File, userID, memberRole(team, userID))
+	}
+	return results, nil
+}
+
+// MoveFileToTeam hands a personal file over to a team the user can upload to
+func MoveFileToTeam(ctx context.Context, fileID, userID, teamID string) (models.File, error) {
+	file, err := loadFile(fileID, userID, AccessOwner)
+	if err != nil {
+		return models.File{}, err
+	}
+	if file.TeamID != "" {
+		return models.File{}, errors.New("file already belongs to a team")
+	}
+
+	team, err := RequireTeamRole(teamID, userID, TeamRoleMember)
+	if err != nil {
+		return models.File{}, err
+	}
+	if err := checkTeamQuota(team, file.Size); err != nil {
+		return models.File{}, err
+	}
+
+	collection := db.Collection("files")
+	result, err := collection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": file.ID, "owner": file.Owner, "team_id": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"team_id": teamID, "object_key": objectKey(file)}},
+	)
+	if err != nil {
+		return models.File{}, fmt.Errorf("failed to move file to team: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return models.File{}, ErrFileNotFound // Deleted or handed over meanwhile
+	}
+
+	file.TeamID = teamID
+	file.ObjectKey = objectKey(file)
+	publish(ctx, events.FileTransferred{File: eventFile(file), ActorID: userID, PreviousOwner: file.Owner})
+	return file, nil
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/arzan03/SecureShare/internal/db"
+	"github.com/arzan03/SecureShare/internal/events"
+	"github.com/arzan03/SecureShare/internal/models"
+	"github.com/arzan03/SecureShare/internal/utils"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// TrashRetention returns how long trashed files are kept before being purged
+func TrashRetention() time.Duration {
+	return settings.Maintenance.TrashRetention()
+}
+
+// TrashFile moves a file into the trash instead of deleting it
+func TrashFile(ctx context.Context, fileID, userID string) error {
+	file, err := loadFile(fileID, userID, AccessOwner)
+	if err != nil {
+		return err
+	}
+
+	collection := db.Collection("files")
+	result, err := collection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": file.ID, "deleted_at": bson.M{"$exists": false}},
+		bson.M{
+			"$set":   bson.M{"deleted_at": time.Now()},
+			"$unset": bson.M{"download_token": ""}, // Outstanding links must not survive the delete
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to move file to trash: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrFileNotFound
+	}
+
+	publish(ctx, events.FileDeleted{File: eventFile(file), ActorID: userID})
+
+	return nil
+}
+
+// ListTrash returns the trashed personal files of a user, or of a team when teamID
+// is set and the user administers it
+func ListTrash(userID, teamID string) ([]models.File, error) {
+	filter := bson.M{"owner": userID, "team_id": bson.M{"$exists": false}, "deleted_at": bson.M{"$exists": true}}
+	if teamID != "" {
+		if _, err := RequireTeamRole(teamID, userID, TeamRoleAdmin); err != nil {
+			return nil, err
+		}
+		filter = bson.M{"team_id": teamID, "deleted_at": bson.M{"$exists": true}}
+	}
+
+	collection := db.Collection("files")
+
+	cursor, err := collection.Find(context.TODO(), filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve trash: %w", err)
+	}
+	defer cursor.Close(context.TODO())
+
+	files := []models.File{}
+	if err = cursor.All(context.TODO(), &files); err != nil {
+		return nil, fmt.Errorf("error decoding trashed files: %w", err)
+	}
+
+	return files, nil
+}
+
+// RestoreFile takes a file back out of the trash
+func RestoreFile(fileID, userID string) error {
+	file, err := loadTrashedFile(fileID, userID, AccessOwner)
+	if err != nil {
+		return err
+	}
+
+	collection := db.Collection("files")
+	_, err = collection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": file.ID},
+		bson.M{"$unset": bson.M{"deleted_at": ""}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to restore file: %w", err)
+	}
+
+	return nil
+}
+
+// PurgeFile permanently deletes a trashed file
+func PurgeFile(ctx context.Context, fileID, userID string) error {
+	file, err := loadTrashedFile(fileID, userID, AccessOwner)
+	if err != nil {
+		return err
+	}
+
+	return removeFileParallel(ctx, file, userID)
+}
+
+// EmptyTrash permanently deletes every file in a user's (or team's) trash and returns how many were removed
+func EmptyTrash(ctx context.Context, userID, teamID string) (int, error) {
+	files, err := ListTrash(userID, teamID)
+	if err != nil {
+		return 0, err
+	}
+	return len(files) - len(purgeFiles(ctx, files, userID)), nil
+}
+
+// PurgeExpiredTrash permanently deletes files that have been in the trash longer than retention
+func PurgeExpiredTrash(retention time.Duration) (int, error) {
+	collection := db.Collection("files")
+
+	cutoff := time.Now().Add(-retention)
+	cursor, err := collection.Find(context.TODO(), bson.M{"deleted_at": bson.M{"$lt": cutoff}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to find expired trash: %w", err)
+	}
+	defer cursor.Close(context.TODO())
+
+	var files []models.File
+	if err = cursor.All(context.TODO(), &files); err != nil {
+		return 0, fmt.Errorf("error decoding expired trash: %w", err)
+	}
+
+	return len(files) - len(purgeFiles(context.TODO(), files, "")), nil
+}
+
+// purgeFiles removes files through a worker pool and returns the IDs of those
+// that could not be removed. actorID is the user who asked for the purge, empty
+// for retention purges.
+func purgeFiles(ctx context.Context, files []models.File, actorID string) []string {
+	if len(files) == 0 {
+		return nil
+	}
+
+	pool := utils.NewWorkerPool(5)
+	defer pool.Close()
+
+	var mu sync.Mutex
+	var failed []string
+	for _, f := range files {
+		file := f
+		pool.AddTask(func() {
+			if err := removeFileParallel(ctx, file, actorID); err != nil {
+				log.Printf("Failed to purge file %s: %v", file.ID.Hex(), err)
+				mu.Lock()
+				failed = append(failed, file.ID.Hex())
+				mu.Unlock()
+			}
+		})
+	}
+	pool.Wait()
+
+	return failed
+}
+
+// StartTrashPurger periodically purges expired trash until ctx is cancelled
+func StartTrashPurger(ctx context.Context, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := PurgeExpiredTrash(retention)
+		if err != nil {
+			log.Printf("Trash purge failed: %v", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d expired files from trash", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
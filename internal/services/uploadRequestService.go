@@ -0,0 +1,274 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/arzan03/SecureShare/internal/db"
+	"github.com/arzan03/SecureShare/internal/mailer"
+	"github.com/arzan03/SecureShare/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultRequestMaxFiles    = 10
+	defaultRequestMaxFileSize = 50 << 20 // 50 MB
+	maxUploadRequestLifetime  = 30 * 24 * time.Hour
+)
+
+var ErrUploadRequestUnavailable = errors.New("upload link is invalid, expired or full")
+
+// UploadRequestInput holds the owner's settings for a new upload request link
+type UploadRequestInput struct {
+	Title          string   `json:"title"`
+	Message        string   `json:"message"`
+	ExpiresInHours int      `json:"expires_in_hours"`
+	MaxFiles       int      `json:"max_files"`
+	MaxFileSize    int64    `json:"max_file_size"`
+	AllowedTypes   []string `json:"allowed_types"`
+}
+
+// CreateUploadRequest creates an upload-only link into the owner's space
+func CreateUploadRequest(ownerID string, input UploadRequestInput) (models.UploadRequest, error) {
+	title := strings.TrimSpace(input.Title)
+	if title == "" {
+		return models.UploadRequest{}, errors.New("title is required")
+	}
+
+	lifetime := time.Duration(input.ExpiresInHours) * time.Hour
+	if lifetime <= 0 {
+		lifetime = 7 * 24 * time.Hour // Default to one week
+	}
+	if lifetime > maxUploadRequestLifetime {
+		return models.UploadRequest{}, errors.New("upload links can last at most 30 days")
+	}
+
+	if input.MaxFiles <= 0 {
+		input.MaxFiles = defaultRequestMaxFiles
+	}
+	if input.MaxFileSize <= 0 {
+		input.MaxFileSize = defaultRequestMaxFileSize
+	}
+
+	allowed := []string{}
+	for _, t := range input.AllowedTypes {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			allowed = append(allowed, t)
+		}
+	}
+
+	token, err := generateSecureToken()
+	if err != nil {
+		return models.UploadRequest{}, err
+	}
+
+	request := models.UploadRequest{
+		ID:           primitive.NewObjectID(),
+		Owner:        ownerID,
+		Token:        token,
+		Title:        title,
+		Message:      strings.TrimSpace(input.Message),
+		ExpiresAt:    time.Now().Add(lifetime),
+		MaxFiles:     input.MaxFiles,
+		MaxFileSize:  input.MaxFileSize,
+		AllowedTypes: allowed,
+		CreatedAt:    time.Now(),
+	}
+
+	collection := db.Collection("upload_requests")
+	if _, err := collection.InsertOne(context.TODO(), request); err != nil {
+		return models.UploadRequest{}, fmt.Errorf("failed to create upload request: %w", err)
+	}
+	return request, nil
+}
+
+// ListUploadRequests returns the upload request links a user has created
+func ListUploadRequests(ownerID string) ([]models.UploadRequest, error) {
+	collection := db.Collection("upload_requests")
+
+	cursor, err := collection.Find(context.TODO(), bson.M{"owner": ownerID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve upload requests: %w", err)
+	}
+	defer cursor.Close(context.TODO())
+
+	requests := []models.UploadRequest{}
+	if err = cursor.All(context.TODO(), &requests); err != nil {
+		return nil, fmt.Errorf("error decoding upload requests: %w", err)
+	}
+	return requests, nil
+}
+
+// RevokeUploadRequest stops an upload request link from accepting more files
+func RevokeUploadRequest(requestID, ownerID string) error {
+	objID, err := primitive.ObjectIDFromHex(requestID)
+	if err != nil {
+		return fmt.Errorf("invalid upload request ID: %w", err)
+	}
+
+	collection := db.Collection("upload_requests")
+	result, err := collection.UpdateOne(context.TODO(),
+		bson.M{"_id": objID, "owner": ownerID},
+		bson.M{"$set": bson.M{"revoked": true}})
+	if err != nil {
+		return fmt.Errorf("failed to revoke upload request: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return errors.New("upload request not found")
+	}
+	return nil
+}
+
+// ListUploadRequestFiles returns one page of the files received through an upload request
+func ListUploadRequestFiles(requestID, ownerID string, opts FileListOptions) (FilePage, error) {
+	return ListFiles(bson.M{
+		"owner":             ownerID,
+		"upload_request_id": requestID,
+		"deleted_at":        bson.M{"$exists": false},
+	}, opts)
+}
+
+// usableRequestFilter matches a request token that can still accept a file
+func usableRequestFilter(token string) bson.M {
+	return bson.M{
+		"token":      token,
+		"revoked":    false,
+		"expires_at": bson.M{"$gt": time.Now()},
+		"$expr":      bson.M{"$lt": bson.A{"$files_received", "$max_files"}},
+	}
+}
+
+// GetUploadRequest returns an upload request by its public token if it is still usable
+func GetUploadRequest(token string) (models.UploadRequest, error) {
+	collection := db.Collection("upload_requests")
+
+	var request models.UploadRequest
+	if err := collection.FindOne(context.TODO(), usableRequestFilter(token)).Decode(&request); err != nil {
+		return models.UploadRequest{}, ErrUploadRequestUnavailable
+	}
+	return request, nil
+}
+
+// typeAllowed checks a file against the request's allowed content types and extensions
+func typeAllowed(allowed []string, filename, contentType string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	ext := strings.ToLower(filepath.Ext(filename))
+	contentType = strings.ToLower(contentType)
+	for _, a := range allowed {
+		switch {
+		case strings.HasPrefix(a, "."):
+			if ext == a {
+				return true
+			}
+		case strings.HasSuffix(a, "/*"):
+			if strings.HasPrefix(contentType, strings.TrimSuffix(a, "*")) {
+				return true
+			}
+		case contentType == a:
+			return true
+		}
+	}
+	return false
+}
+
+// UploadViaRequest stores a file sent by an unauthenticated contributor through an
+// upload request link and notifies the link owner
+func UploadViaRequest(c *fiber.Ctx, token string) (models.File, error) {
+	request, err := GetUploadRequest(token)
+	if err != nil {
+		return models.File{}, err
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return models.File{}, errors.New("failed to retrieve file")
+	}
+	if fileHeader.Size > request.MaxFileSize {
+		return models.File{}, fmt.Errorf("file exceeds the %d byte limit", request.MaxFileSize)
+	}
+	contentType := fileHeader.Header.Get("Content-Type")
+	if !typeAllowed(request.AllowedTypes, fileHeader.Filename, contentType) {
+		return models.File{}, errors.New("file type is not accepted by this upload link")
+	}
+
+	fileBytes, err := readUploadedFile(fileHeader)
+	if err != nil {
+		return models.File{}, err
+	}
+
+	// Contributor details are optional and kept as metadata on the file
+	var metadata map[string]string
+	name := strings.TrimSpace(c.FormValue("name"))
+	email := strings.TrimSpace(c.FormValue("email"))
+	if name != "" || email != "" {
+		metadata = map[string]string{}
+		if name != "" {
+			metadata["contributor_name"] = name
+		}
+		if email != "" {
+			metadata["contributor_email"] = email
+		}
+		if err := validateMetadata(metadata); err != nil {
+			return models.File{}, err
+		}
+	}
+
+	// Reserve a slot first so concurrent uploads cannot exceed max_files
+	collection := db.Collection("upload_requests")
+	result, err := collection.UpdateOne(context.TODO(), usableRequestFilter(token),
+		bson.M{"$inc": bson.M{"files_received": 1}})
+	if err != nil || result.ModifiedCount == 0 {
+		return models.File{}, ErrUploadRequestUnavailable
+	}
+
+	fileData, err := storeFile(c.UserContext(), models.File{
+		Filename:        fileHeader.Filename,
+		ContentType:     contentType,
+		Metadata:        metadata,
+		Owner:           request.Owner,
+		UploadRequestID: request.ID.Hex(),
+	}, fileBytes)
+	if err != nil {
+		// Give the slot back
+		collection.UpdateOne(context.TODO(), bson.M{"_id": request.ID}, bson.M{"$inc": bson.M{"files_received": -1}})
+		return models.File{}, err
+	}
+
+	runBackground(func(context.Context) {
+		notifyUploadRequestOwner(request, fileData)
+	})
+
+	return fileData, nil
+}
+
+// notifyUploadRequestOwner emails the owner of an upload request about a new file
+func notifyUploadRequestOwner(request models.UploadRequest, file models.File) {
+	owner, err := findUserByID(request.Owner)
+	if err != nil {
+		log.Printf("Upload request %s: owner lookup failed: %v", request.ID.Hex(), err)
+		return
+	}
+
+	from := "an external contributor"
+	if name := file.Metadata["contributor_name"]; name != "" {
+		from = name
+	}
+
+	body := fmt.Sprintf("%s uploaded %q (%d bytes) through your upload link %q.\n\nFile ID: %s\n",
+		from, file.Filename, file.Size, request.Title, file.ID.Hex())
+	if err := mailer.Send(owner.Email, "New file received: "+file.Filename, body); err != nil {
+		log.Printf("Upload request %s: %v", request.ID.Hex(), err)
+	}
+}
@@ -0,0 +1,485 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+
+	"github.com/arzan03/SecureShare/internal/db"
+	"github.com/arzan03/SecureShare/internal/events"
+	"github.com/arzan03/SecureShare/internal/mailer"
+	"github.com/arzan03/SecureShare/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Account roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+var (
+	ErrUserNotFound           = errors.New("user not found")
+	ErrAccountSuspended       = errors.New("account suspended")
+	ErrPasswordResetRequired  = errors.New("password reset required")
+	ErrSessionRevoked         = errors.New("session revoked; log in again")
+	ErrInvalidResetToken      = errors.New("invalid or expired reset token")
+	ErrCannotModifySelf       = errors.New("admins cannot suspend, demote or delete their own account")
+	ErrInvalidRole            = errors.New("role must be user or admin")
+	ErrPasswordTooShort       = errors.New("password must be at least 8 characters")
+	ErrCannotImpersonate      = errors.New("admins cannot impersonate themselves or other admins")
+	ErrUserDeletionIncomplete = errors.New("some of the user's files could not be deleted; the account stays suspended, try again")
+	ErrSoleTeamOwner          = errors.New("the user is the only owner of a team; make another member an owner first")
+)
+
+// AdminUserView is what admins see of an account: its state and usage, never its credentials
+type AdminUserView struct {
+	ID                    string     `json:"id"`
+	Email                 string     `json:"email"`
+	Role                  string     `json:"role"`
+	CreatedAt             time.Time  `json:"created_at"`
+	LastLoginAt           *time.Time `json:"last_login_at"`
+	TwoFactorEnabled      bool       `json:"two_factor_enabled"` // Always false: two-factor login is not supported yet
+	Suspended             bool       `json:"suspended"`
+	SuspendedAt           *time.Time `json:"suspended_at,omitempty"`
+	SuspendReason         string     `json:"suspend_reason,omitempty"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	FileCount             int64      `json:"file_count"`   // Files the user uploaded, trashed ones included
+	StorageUsed           int64      `json:"storage_used"` // Bytes of those files
+}
+
+// AdminUserPage is one page of the admin user listing
+type AdminUserPage struct {
+	Users []AdminUserView `json:"users"`
+	Total int64           `json:"total"`
+}
+
+// adminUserRow is a user document joined with its file usage
+type adminUserRow struct {
+	models.User `bson:",inline"`
+	Usage       []struct {
+		Files int64 `bson:"files"`
+		Bytes int64 `bson:"bytes"`
+	} `bson:"usage"`
+}
+
+func (row adminUserRow) view() AdminUserView {
+	v := AdminUserView{
+		ID:                    row.ID.Hex(),
+		Email:                 row.Email,
+		Role:                  row.Role,
+		CreatedAt:             row.CreatedAt,
+		LastLoginAt:           row.LastLoginAt,
+		Suspended:             row.Suspended,
+		SuspendedAt:           row.SuspendedAt,
+		SuspendReason:         row.SuspendReason,
+		PasswordResetRequired: row.PasswordResetRequired,
+	}
+	if len(row.Usage) > 0 {
+		v.FileCount, v.StorageUsed = row.Usage[0].Files, row.Usage[0].Bytes
+	}
+	return v
+}
+
+// adminUserViews loads the users matching filter with their file usage, newest first
+func adminUserViews(filter bson.M, skip, limit int64) ([]AdminUserView, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$sort", Value: bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}}},
+		{{Key: "$skip", Value: skip}},
+		{{Key: "$limit", Value: limit}},
+		// Credentials never leave the database
+		{{Key: "$project", Value: bson.M{"password": 0, "password_reset_token_hash": 0}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from": "files",
+			"let":  bson.M{"owner": bson.M{"$toString": "$_id"}},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$owner", "$$owner"}}}},
+				bson.M{"$group": bson.M{"_id": nil, "files": bson.M{"$sum": 1}, "bytes": bson.M{"$sum": "$size"}}},
+			},
+			"as": "usage",
+		}}},
+	}
+
+	collection := db.Collection("users")
+	cursor, err := collection.Aggregate(context.TODO(), pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch users: %w", err)
+	}
+	defer cursor.Close(context.TODO())
+
+	var rows []adminUserRow
+	if err := cursor.All(context.TODO(), &rows); err != nil {
+		return nil, fmt.Errorf("error decoding users: %w", err)
+	}
+
+	views := make([]AdminUserView, 0, len(rows))
+	for _, row := range rows {
+		views = append(views, row.view())
+	}
+	return views, nil
+}
+
+// ListUsersForAdmin returns one page of users, newest first; email filters by a case-insensitive substring
+func ListUsersForAdmin(email string, offset, limit int64) (AdminUserPage, error) {
+	if limit <= 0 || limit > MaxPageSize {
+		limit = DefaultPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	filter := bson.M{}
+	if email != "" {
+		filter["email"] = bson.M{"$regex": regexp.QuoteMeta(email), "$options": "i"}
+	}
+
+	total, err := db.Collection("users").CountDocuments(context.TODO(), filter)
+	if err != nil {
+		return AdminUserPage{}, fmt.Errorf("failed to count users: %w", err)
+	}
+	users, err := adminUserViews(filter, offset, limit)
+	if err != nil {
+		return AdminUserPage{}, err
+	}
+	return AdminUserPage{Users: users, Total: total}, nil
+}
+
+// GetUserForAdmin returns one user's admin view
+func GetUserForAdmin(userID string) (AdminUserView, error) {
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return AdminUserView{}, ErrUserNotFound
+	}
+	users, err := adminUserViews(bson.M{"_id": objID}, 0, 1)
+	if err != nil {
+		return AdminUserView{}, err
+	}
+	if len(users) == 0 {
+		return AdminUserView{}, ErrUserNotFound
+	}
+	return users[0], nil
+}
+
+// CheckSession verifies that the account behind a token may still use the API:
+// it must exist, not be suspended, and the token must have been issued after
+// the account's sessions were last revoked.
+func CheckSession(userID string, issuedAt time.Time) error {
+	user, err := findUserByID(userID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+	if user.Suspended {
+		return ErrAccountSuspended
+	}
+	// Token issue times only have second precision
+	if user.SessionsRevokedAt != nil && issuedAt.Before(user.SessionsRevokedAt.Truncate(time.Second)) {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+// loadManagedUser loads the target of an admin action, refusing actions on the admin's own account
+func loadManagedUser(adminID, userID string) (models.User, error) {
+	if adminID == userID {
+		return models.User{}, ErrCannotModifySelf
+	}
+	user, err := findUserByID(userID)
+	if err != nil {
+		return models.User{}, ErrUserNotFound
+	}
+	return user, nil
+}
+
+// updateUser applies an update to a user and returns the result
+func updateUser(user models.User, update bson.M) (models.User, error) {
+	collection := db.Collection("users")
+	if _, err := collection.UpdateOne(context.TODO(), bson.M{"_id": user.ID}, update); err != nil {
+		return models.User{}, fmt.Errorf("failed to update user: %w", err)
+	}
+	return findUserByID(user.ID.Hex())
+}
+
+// SuspendUser blocks a user from logging in or using existing tokens
+func SuspendUser(adminID, userID, reason string) (models.User, error) {
+	user, err := loadManagedUser(adminID, userID)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	set := bson.M{"suspended": true, "suspended_at": time.Now()}
+	update := bson.M{"$set": set}
+	if reason != "" {
+		set["suspend_reason"] = reason
+	} else {
+		update["$unset"] = bson.M{"suspend_reason": ""}
+	}
+	if user, err = updateUser(user, update); err != nil {
+		return models.User{}, err
+	}
+
+	publish(context.TODO(), events.UserSuspended{UserID: userID, Email: user.Email, ActorID: adminID, Reason: reason})
+	return user, nil
+}
+
+// ReactivateUser lifts a suspension
+func ReactivateUser(adminID, userID string) (models.User, error) {
+	user, err := loadManagedUser(adminID, userID)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user, err = updateUser(user, bson.M{"$unset": bson.M{"suspended": "", "suspended_at": "", "suspend_reason": ""}})
+	if err != nil {
+		return models.User{}, err
+	}
+
+	publish(context.TODO(), events.UserReactivated{UserID: userID, Email: user.Email, ActorID: adminID})
+	return user, nil
+}
+
+// ChangeUserRole sets a user's role. Existing tokens carry the old role, so they are revoked.
+func ChangeUserRole(adminID, userID, role string) (models.User, error) {
+	if role != RoleUser && role != RoleAdmin {
+		return models.User{}, ErrInvalidRole
+	}
+	user, err := loadManagedUser(adminID, userID)
+	if err != nil {
+		return models.User{}, err
+	}
+	oldRole := user.Role
+	if oldRole == role {
+		return user, nil
+	}
+
+	user, err = updateUser(user, bson.M{"$set": bson.M{"role": role, "sessions_revoked_at": time.Now()}})
+	if err != nil {
+		return models.User{}, err
+	}
+
+	publish(context.TODO(), events.UserRoleChanged{UserID: userID, Email: user.Email, ActorID: adminID, OldRole: oldRole, NewRole: role})
+	return user, nil
+}
+
+// hashResetToken returns the stored form of a password reset token
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ForcePasswordReset signs the user out everywhere and emails them a token to
+// choose a new password with. They cannot log in until they do.
+func ForcePasswordReset(adminID, userID string) error {
+	user, err := loadManagedUser(adminID, userID)
+	if err != nil {
+		return err
+	}
+
+	token, err := generateSecureToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	expires := now.Add(settings.Auth.PasswordResetTTL)
+
+	_, err = updateUser(user, bson.M{"$set": bson.M{
+		"password_reset_required":   true,
+		"password_reset_token_hash": hashResetToken(token),
+		"password_reset_expires":    expires,
+		"sessions_revoked_at":       now,
+	}})
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("An administrator has required you to choose a new password.\n\n"+
+		"Send your new password with this token to POST /auth/reset-password before %s:\n\n%s\n",
+		expires.UTC().Format(time.RFC1123), token)
+	if err := mailer.Send(user.Email, "Password reset required", body); err != nil {
+		log.Printf("Password reset email for %s failed: %v", userID, err)
+	}
+
+	publish(context.TODO(), events.PasswordResetForced{UserID: userID, Email: user.Email, ActorID: adminID})
+	return nil
+}
+
+// ResetPassword sets a new password using a token from ForcePasswordReset
+func ResetPassword(token, password, ip string) error {
+	if len(password) < 8 {
+		return ErrPasswordTooShort
+	}
+	if token == "" {
+		return ErrInvalidResetToken
+	}
+
+	hashedPassword, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	collection := db.Collection("users")
+	var user models.User
+	err = collection.FindOneAndUpdate(context.TODO(),
+		bson.M{
+			"password_reset_token_hash": hashResetToken(token),
+			"password_reset_expires":    bson.M{"$gt": time.Now()},
+		},
+		bson.M{
+			"$set":   bson.M{"password": hashedPassword},
+			"$unset": bson.M{"password_reset_required": "", "password_reset_token_hash": "", "password_reset_expires": ""},
+		},
+	).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return fmt.Errorf("failed to reset password: %w", err)
+	}
+
+	publish(context.TODO(), events.PasswordReset{UserID: user.ID.Hex(), Email: user.Email, IP: ip})
+	return nil
+}
+
+// DeleteUser removes a user's account together with their personal files (trashed
+// or not), share links, upload requests, webhooks, notifications and access
+// grants. Team files stay with their team. The account is suspended first so
+// it cannot be used while its data is being removed. Users who are the only
+// owner of a team are refused, so no team is left without an owner.
+func DeleteUser(adminID, userID string) (int, error) {
+	user, err := loadManagedUser(adminID, userID)
+	if err != nil {
+		return 0, err
+	}
+	if err := checkNoSoleOwnership(userID); err != nil {
+		return 0, err
+	}
+	if _, err := updateUser(user, bson.M{"$set": bson.M{"suspended": true, "suspended_at": time.Now()}}); err != nil {
+		return 0, err
+	}
+
+	ctx := context.TODO()
+	files := db.Collection("files")
+
+	cursor, err := files.Find(ctx, bson.M{"owner": userID, "team_id": bson.M{"$exists": false}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to find user's files: %w", err)
+	}
+	var owned []models.File
+	if err = cursor.All(ctx, &owned); err != nil {
+		return 0, fmt.Errorf("error decoding user's files: %w", err)
+	}
+	deleted := len(owned) - len(purgeFiles(context.TODO(), owned, adminID))
+	if deleted < len(owned) {
+		return deleted, ErrUserDeletionIncomplete
+	}
+
+	// Webhook deliveries are keyed by webhook, so find the user's hooks first
+	webhooks := db.Collection("webhooks")
+	var hooks []models.Webhook
+	cursor, err = webhooks.Find(ctx, bson.M{"owner": userID})
+	if err == nil {
+		err = cursor.All(ctx, &hooks)
+	}
+	if err != nil {
+		return deleted, fmt.Errorf("failed to find user's webhooks: %w", err)
+	}
+	hookIDs := make([]interface{}, 0, len(hooks))
+	for _, hook := range hooks {
+		hookIDs = append(hookIDs, hook.ID)
+	}
+
+	cleanups := []struct {
+		collection string
+		filter     bson.M
+	}{
+		{"webhook_deliveries", bson.M{"webhook_id": bson.M{"$in": hookIDs}}},
+		{"webhooks", bson.M{"owner": userID}},
+		{"upload_requests", bson.M{"owner": userID}},
+		{"access_logs", bson.M{"owner": userID}},
+		{"notifications", bson.M{"user_id": userID}},
+		{"notification_preferences", bson.M{"user_id": userID}},
+	}
+	for _, cleanup := range cleanups {
+		if _, err := db.Collection(cleanup.collection).DeleteMany(ctx, cleanup.filter); err != nil {
+			return deleted, fmt.Errorf("failed to delete user's %s: %w", cleanup.collection, err)
+		}
+	}
+
+	// Drop the user from other people's files and from teams
+	if _, err := files.UpdateMany(ctx, bson.M{"shares.user_id": userID},
+		bson.M{"$pull": bson.M{"shares": bson.M{"user_id": userID}}}); err != nil {
+		return deleted, fmt.Errorf("failed to remove user's shares: %w", err)
+	}
+	// Teams the user became the only owner of meanwhile keep them
+	if _, err := db.Collection("teams").UpdateMany(ctx,
+		bson.M{"members.user_id": userID, "$nor": bson.A{soleOwnerOf(userID)}},
+		bson.M{"$pull": bson.M{"members": bson.M{"user_id": userID}}}); err != nil {
+		return deleted, fmt.Errorf("failed to remove user's team memberships: %w", err)
+	}
+	if err := checkNoSoleOwnership(userID); err != nil {
+		return deleted, err
+	}
+
+	if _, err := db.Collection("users").DeleteOne(ctx, bson.M{"_id": user.ID}); err != nil {
+		return deleted, fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	publish(context.TODO(), events.UserDeleted{UserID: userID, Email: user.Email, ActorID: adminID, FilesDeleted: deleted})
+	return deleted, nil
+}
+
+// checkNoSoleOwnership refuses with ErrSoleTeamOwner if the user is the only owner of a team
+func checkNoSoleOwnership(userID string) error {
+	n, err := db.Collection("teams").CountDocuments(context.TODO(), soleOwnerOf(userID))
+	if err != nil {
+		return fmt.Errorf("failed to check user's teams: %w", err)
+	}
+	if n > 0 {
+		return ErrSoleTeamOwner
+	}
+	return nil
+}
+
+// ImpersonateUser issues a short-lived token acting as a user on behalf of an
+// admin. The token carries the admin in an "impersonator" claim, so every
+// request made with it can be told apart and audited.
+func ImpersonateUser(adminID, userID string) (string, time.Time, error) {
+	if adminID == userID {
+		return "", time.Time{}, ErrCannotImpersonate
+	}
+	user, err := findUserByID(userID)
+	if err != nil {
+		return "", time.Time{}, ErrUserNotFound
+	}
+	if user.Role == RoleAdmin {
+		return "", time.Time{}, ErrCannotImpersonate
+	}
+	if user.Suspended {
+		return "", time.Time{}, ErrAccountSuspended
+	}
+
+	now := time.Now()
+	expires := now.Add(settings.Auth.ImpersonationTTL) // Cannot be refreshed
+	claims := jwt.MapClaims{
+		"user_id":      userID,
+		"role":         user.Role,
+		"impersonator": adminID,
+		"iat":          now.Unix(),
+		"exp":          expires.Unix(),
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(getJWTSecret())
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to sign impersonation token: %w", err)
+	}
+
+	publish(context.TODO(), events.UserImpersonated{UserID: userID, Email: user.Email, ActorID: adminID, ExpiresAt: expires})
+	return token, expires, nil
+}
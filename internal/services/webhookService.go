@@ -0,0 +1,581 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/arzan03/SecureShare/internal/db"
+	"github.com/arzan03/SecureShare/internal/events"
+	"github.com/arzan03/SecureShare/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	webhookMaxAttempts = 6
+	webhookBaseBackoff = 30 * time.Second
+	webhookMaxBackoff  = time.Hour
+	webhookLease       = 2 * time.Minute // How long an attempt may run before the dispatcher retries it
+	webhookBatchSize   = 50
+)
+
+var (
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("delivery not found")
+	ErrWebhookAddress   = errors.New("webhook address is not public")
+)
+
+// webhookClient delivers webhooks and notification webhooks. Every address is
+// checked after DNS resolution, and redirects are returned rather than followed,
+// so a receiver cannot point deliveries at internal services.
+var webhookClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 5 * time.Second, Control: checkWebhookDial}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+		MaxIdleConnsPerHost: 4,
+		IdleConnTimeout:     90 * time.Second,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// checkWebhookDial refuses connections to non-public addresses unless ALLOW_PRIVATE_WEBHOOKS is set
+func checkWebhookDial(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !webhookAddressAllowed(addr) {
+		return fmt.Errorf("%w: %s", ErrWebhookAddress, addr)
+	}
+	return nil
+}
+
+// nonPublicPrefixes are the networks deliveries may not connect to
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "This" network
+	netip.MustParsePrefix("10.0.0.0/8"),      // Private
+	netip.MustParsePrefix("100.64.0.0/10"),   // Carrier-grade NAT
+	netip.MustParsePrefix("127.0.0.0/8"),     // Loopback
+	netip.MustParsePrefix("169.254.0.0/16"),  // Link-local, including cloud metadata services
+	netip.MustParsePrefix("172.16.0.0/12"),   // Private
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // Documentation
+	netip.MustParsePrefix("192.168.0.0/16"),  // Private
+	netip.MustParsePrefix("198.18.0.0/15"),   // Benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // Documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // Documentation
+	netip.MustParsePrefix("224.0.0.0/4"),     // Multicast
+	netip.MustParsePrefix("240.0.0.0/4"),     // Reserved, including broadcast
+	netip.MustParsePrefix("::/128"),          // Unspecified
+	netip.MustParsePrefix("::1/128"),         // Loopback
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64, which can reach any IPv4 address
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // Local-use NAT64
+	netip.MustParsePrefix("100::/64"),        // Discard-only
+	netip.MustParsePrefix("2001:db8::/32"),   // Documentation
+	netip.MustParsePrefix("fc00::/7"),        // Unique local
+	netip.MustParsePrefix("fe80::/10"),       // Link-local
+	netip.MustParsePrefix("ff00::/8"),        // Multicast
+}
+
+// webhookAddressAllowed reports whether deliveries may connect to addr
+func webhookAddressAllowed(addr netip.Addr) bool {
+	if settings.Webhooks.AllowPrivate {
+		return true
+	}
+	addr = addr.Unmap()
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateWebhookURL checks a receiver URL when it is saved. Hostnames are
+// only checked when a delivery connects, since they may resolve differently.
+func validateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an http or https URL")
+	}
+	host := u.Hostname()
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !webhookAddressAllowed(addr) {
+			return ErrWebhookAddress
+		}
+	} else if host = strings.ToLower(strings.TrimSuffix(host, ".")); host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		if !settings.Webhooks.AllowPrivate {
+			return ErrWebhookAddress
+		}
+	}
+	return nil
+}
+
+// webhookEvents lists the events a webhook may subscribe to
+var webhookEvents = map[string]bool{
+	models.EventFileUploaded: true,
+	models.EventFileDeleted:  true,
+	models.EventFileExpired:  true,
+	models.EventLinkCreated:  true,
+	models.EventLinkRedeemed: true,
+}
+
+// WebhookInput holds the settings for a new webhook
+type WebhookInput struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+// WebhookEvent is the JSON body delivered to webhook endpoints
+type WebhookEvent struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// fileEventData is the file summary included in file and link events
+type fileEventData struct {
+	FileID      string   `json:"file_id"`
+	Filename    string   `json:"filename"`
+	Size        int64    `json:"size"`
+	ContentType string   `json:"content_type,omitempty"`
+	Owner       string   `json:"owner"`
+	TeamID      string   `json:"team_id,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+}
+
+func newFileEventData(file models.File) fileEventData {
+	return fileEventData{
+		FileID:      file.ID.Hex(),
+		Filename:    file.Filename,
+		Size:        file.Size,
+		ContentType: file.ContentType,
+		Owner:       file.Owner,
+		TeamID:      file.TeamID,
+		Tags:        file.Tags,
+	}
+}
+
+// linkEventData describes a share link in link events
+type linkEventData struct {
+	fileEventData
+	LinkID       string    `json:"link_id"`
+	TokenType    string    `json:"token_type"`
+	TokenExpires time.Time `json:"token_expires"`
+	NotBefore    time.Time `json:"not_before,omitempty"`
+	IP           string    `json:"ip,omitempty"`         // Redeeming client, for link.redeemed
+	UserAgent    string    `json:"user_agent,omitempty"` // Redeeming client, for link.redeemed
+}
+
+func newLinkEventData(file models.File) linkEventData {
+	return linkEventData{
+		fileEventData: newFileEventData(file),
+		LinkID:        file.LinkID,
+		TokenType:     file.TokenType,
+		TokenExpires:  file.TokenExpires,
+		NotBefore:     file.TokenNotBefore,
+	}
+}
+
+// CreateWebhook registers an endpoint for the owner's events, or for everyone's when global.
+// The signing secret is returned only here.
+func CreateWebhook(ownerID string, global bool, input WebhookInput) (models.Webhook, string, error) {
+	if err := validateWebhookURL(input.URL); err != nil {
+		return models.Webhook{}, "", err
+	}
+	if len(input.Events) == 0 {
+		return models.Webhook{}, "", errors.New("at least one event is required")
+	}
+	for _, e := range input.Events {
+		if !webhookEvents[e] {
+			return models.Webhook{}, "", fmt.Errorf("unknown event %q", e)
+		}
+	}
+
+	secret, err := generateSecureToken()
+	if err != nil {
+		return models.Webhook{}, "", err
+	}
+
+	webhook := models.Webhook{
+		ID:        primitive.NewObjectID(),
+		Owner:     ownerID,
+		Global:    global,
+		URL:       input.URL,
+		Secret:    secret,
+		Events:    input.Events,
+		Active:    true,
+		CreatedAt: time.Now(),
+	}
+
+	collection := db.Collection("webhooks")
+	if _, err := collection.InsertOne(context.TODO(), webhook); err != nil {
+		return models.Webhook{}, "", fmt.Errorf("failed to create webhook: %w", err)
+	}
+	return webhook, secret, nil
+}
+
+// ListWebhooks returns the webhooks a user registered
+func ListWebhooks(ownerID string) ([]models.Webhook, error) {
+	return findWebhooks(bson.M{"owner": ownerID})
+}
+
+// ListGlobalWebhooks returns the admin webhooks that receive every user's events
+func ListGlobalWebhooks() ([]models.Webhook, error) {
+	return findWebhooks(bson.M{"global": true})
+}
+
+func findWebhooks(filter bson.M) ([]models.Webhook, error) {
+	collection := db.Collection("webhooks")
+
+	cursor, err := collection.Find(context.TODO(), filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve webhooks: %w", err)
+	}
+	defer cursor.Close(context.TODO())
+
+	webhooks := []models.Webhook{}
+	if err = cursor.All(context.TODO(), &webhooks); err != nil {
+		return nil, fmt.Errorf("error decoding webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+// loadWebhook fetches a webhook owned by the user
+func loadWebhook(webhookID, ownerID string) (models.Webhook, error) {
+	objID, err := primitive.ObjectIDFromHex(webhookID)
+	if err != nil {
+		return models.Webhook{}, ErrWebhookNotFound
+	}
+
+	var webhook models.Webhook
+	collection := db.Collection("webhooks")
+	if err := collection.FindOne(context.TODO(), bson.M{"_id": objID, "owner": ownerID}).Decode(&webhook); err != nil {
+		return models.Webhook{}, ErrWebhookNotFound
+	}
+	return webhook, nil
+}
+
+// DeleteWebhook removes a webhook and its delivery log
+func DeleteWebhook(webhookID, ownerID string) error {
+	webhook, err := loadWebhook(webhookID, ownerID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.Collection("webhooks").DeleteOne(context.TODO(), bson.M{"_id": webhook.ID}); err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	if _, err := db.Collection("webhook_deliveries").DeleteMany(context.TODO(), bson.M{"webhook_id": webhook.ID}); err != nil {
+		log.Printf("Failed to delete deliveries of webhook %s: %v", webhook.ID.Hex(), err)
+	}
+	return nil
+}
+
+// ListWebhookDeliveries returns a webhook's most recent deliveries, newest first
+func ListWebhookDeliveries(webhookID, ownerID string, limit int) ([]models.WebhookDelivery, error) {
+	webhook, err := loadWebhook(webhookID, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > MaxPageSize {
+		limit = DefaultPageSize
+	}
+
+	collection := db.Collection("webhook_deliveries")
+	cursor, err := collection.Find(context.TODO(), bson.M{"webhook_id": webhook.ID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve deliveries: %w", err)
+	}
+	defer cursor.Close(context.TODO())
+
+	deliveries := []models.WebhookDelivery{}
+	if err = cursor.All(context.TODO(), &deliveries); err != nil {
+		return nil, fmt.Errorf("error decoding deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// RedeliverWebhook sends a past delivery's payload again as a new delivery and returns its outcome
+func RedeliverWebhook(webhookID, deliveryID, ownerID string) (models.WebhookDelivery, error) {
+	webhook, err := loadWebhook(webhookID, ownerID)
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+	objID, err := primitive.ObjectIDFromHex(deliveryID)
+	if err != nil {
+		return models.WebhookDelivery{}, ErrDeliveryNotFound
+	}
+
+	collection := db.Collection("webhook_deliveries")
+	var original models.WebhookDelivery
+	if err := collection.FindOne(context.TODO(), bson.M{"_id": objID, "webhook_id": webhook.ID}).Decode(&original); err != nil {
+		return models.WebhookDelivery{}, ErrDeliveryNotFound
+	}
+
+	delivery, err := queueDelivery(webhook, original.Event, original.Payload)
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+	return attemptDelivery(webhook, delivery), nil
+}
+
+// emitWebhookEvent queues an event for the user's webhooks and every global webhook
+// subscribed to it, then makes the first delivery attempts
+func emitWebhookEvent(event, userID string, data interface{}) error {
+	collection := db.Collection("webhooks")
+	cursor, err := collection.Find(context.TODO(), bson.M{
+		"active": true,
+		"events": event,
+		"$or":    bson.A{bson.M{"owner": userID}, bson.M{"global": true}},
+	})
+	if err != nil {
+		return fmt.Errorf("webhook lookup failed: %w", err)
+	}
+	var webhooks []models.Webhook
+	if err := cursor.All(context.TODO(), &webhooks); err != nil {
+		return fmt.Errorf("webhook lookup failed: %w", err)
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(WebhookEvent{
+		ID:        primitive.NewObjectID().Hex(),
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", event, err)
+	}
+
+	for _, webhook := range webhooks {
+		delivery, err := queueDelivery(webhook, event, string(payload))
+		if err != nil {
+			log.Printf("Failed to queue %s for webhook %s: %v", event, webhook.ID.Hex(), err)
+			continue
+		}
+		runBackground(func(context.Context) {
+			attemptDelivery(webhook, delivery)
+		})
+	}
+	return nil
+}
+
+// webhookSubscriber forwards bus events to the subscribed webhooks
+func webhookSubscriber(ctx context.Context, e events.Event) error {
+	switch p := e.Payload.(type) {
+	case events.FileUploaded:
+		return emitWebhookEvent(e.Type, p.File.Owner, newFileEventData(p.File))
+	case events.FileDeleted:
+		return emitWebhookEvent(e.Type, p.File.Owner, struct {
+			fileEventData
+			Permanent bool `json:"permanent"`
+		}{newFileEventData(p.File), p.Permanent})
+	case events.FileExpired:
+		return emitWebhookEvent(e.Type, p.File.Owner, struct {
+			fileEventData
+			ExpiresAt time.Time `json:"expires_at"`
+		}{newFileEventData(p.File), p.File.ExpiresAt})
+	case events.LinkCreated:
+		return emitWebhookEvent(e.Type, p.File.Owner, newLinkEventData(p.File))
+	case events.LinkRedeemed:
+		data := newLinkEventData(p.File)
+		data.IP, data.UserAgent = p.IP, p.UserAgent
+		return emitWebhookEvent(e.Type, p.File.Owner, data)
+	}
+	return nil
+}
+
+// queueDelivery stores a pending delivery. Its first retry time is one lease
+// away, so the dispatcher only picks it up if the immediate attempt never finishes.
+func queueDelivery(webhook models.Webhook, event, payload string) (models.WebhookDelivery, error) {
+	now := time.Now()
+	delivery := models.WebhookDelivery{
+		ID:            primitive.NewObjectID(),
+		WebhookID:     webhook.ID,
+		Event:         event,
+		Payload:       payload,
+		Status:        models.DeliveryPending,
+		NextAttemptAt: now.Add(webhookLease),
+		CreatedAt:     now,
+	}
+
+	collection := db.Collection("webhook_deliveries")
+	if _, err := collection.InsertOne(context.TODO(), delivery); err != nil {
+		return models.WebhookDelivery{}, fmt.Errorf("failed to queue delivery: %w", err)
+	}
+	return delivery, nil
+}
+
+// SignWebhookPayload computes the X-SecureShare-Signature value for a timestamp and body
+func SignWebhookPayload(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff returns the wait before the next attempt, doubling each time
+func webhookBackoff(attempts int) time.Duration {
+	backoff := webhookBaseBackoff << (attempts - 1)
+	if backoff <= 0 || backoff > webhookMaxBackoff {
+		return webhookMaxBackoff
+	}
+	return backoff
+}
+
+// sendWebhook posts a signed payload and returns the response status
+func sendWebhook(webhook models.Webhook, delivery models.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "SecureShare-Webhooks")
+	req.Header.Set("X-SecureShare-Event", delivery.Event)
+	req.Header.Set("X-SecureShare-Delivery", delivery.ID.Hex())
+	req.Header.Set("X-SecureShare-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-SecureShare-Signature", SignWebhookPayload(webhook.Secret, timestamp, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) // Let the connection be reused
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// attemptDelivery makes one delivery attempt and records the outcome, scheduling
+// a retry with exponential backoff until the attempts run out
+func attemptDelivery(webhook models.Webhook, delivery models.WebhookDelivery) models.WebhookDelivery {
+	statusCode, err := sendWebhook(webhook, delivery)
+	now := time.Now()
+
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+	set := bson.M{"attempts": delivery.Attempts, "last_status_code": statusCode}
+	unset := bson.M{}
+
+	switch {
+	case err == nil:
+		delivery.Status = models.DeliverySucceeded
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+		set["delivered_at"] = now
+		unset["last_error"] = ""
+		unset["next_attempt_at"] = ""
+	case delivery.Attempts >= webhookMaxAttempts:
+		delivery.Status = models.DeliveryFailed
+		delivery.LastError = err.Error()
+		set["last_error"] = delivery.LastError
+		unset["next_attempt_at"] = ""
+	default:
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = now.Add(webhookBackoff(delivery.Attempts))
+		set["last_error"] = delivery.LastError
+		set["next_attempt_at"] = delivery.NextAttemptAt
+	}
+	set["status"] = delivery.Status
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	collection := db.Collection("webhook_deliveries")
+	if _, err := collection.UpdateOne(context.TODO(), bson.M{"_id": delivery.ID}, update); err != nil {
+		log.Printf("Failed to record delivery %s: %v", delivery.ID.Hex(), err)
+	}
+	return delivery
+}
+
+// RetryWebhookDeliveries attempts every pending delivery that is due and returns how many were tried
+func RetryWebhookDeliveries() (int, error) {
+	deliveries := db.Collection("webhook_deliveries")
+	webhooks := db.Collection("webhooks")
+
+	attempted := 0
+	for attempted < webhookBatchSize {
+		// Claim one due delivery by pushing its next attempt a lease into the future
+		now := time.Now()
+		var delivery models.WebhookDelivery
+		err := deliveries.FindOneAndUpdate(context.TODO(),
+			bson.M{"status": models.DeliveryPending, "next_attempt_at": bson.M{"$lte": now}},
+			bson.M{"$set": bson.M{"next_attempt_at": now.Add(webhookLease)}},
+			options.FindOneAndUpdate().SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}),
+		).Decode(&delivery)
+		if err != nil {
+			break // No due deliveries left
+		}
+
+		var webhook models.Webhook
+		if err := webhooks.FindOne(context.TODO(), bson.M{"_id": delivery.WebhookID, "active": true}).Decode(&webhook); err != nil {
+			// The webhook is gone or disabled; stop retrying
+			deliveries.UpdateOne(context.TODO(), bson.M{"_id": delivery.ID}, bson.M{
+				"$set":   bson.M{"status": models.DeliveryFailed, "last_error": "webhook no longer active"},
+				"$unset": bson.M{"next_attempt_at": ""},
+			})
+			continue
+		}
+
+		attemptDelivery(webhook, delivery)
+		attempted++
+	}
+	return attempted, nil
+}
+
+// StartWebhookDispatcher retries due webhook deliveries every interval until ctx is cancelled
+func StartWebhookDispatcher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if attempted, err := RetryWebhookDeliveries(); err != nil {
+			log.Printf("Webhook retry failed: %v", err)
+		} else if attempted > 0 {
+			log.Printf("Retried %d webhook deliveries", attempted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -2,38 +2,47 @@ package storage
 
 import (
 	"context"
+	"crypto/x509"
 	"fmt"
 	"log"
 	"os"
 	"time"
 
+	"github.com/arzan03/SecureShare/internal/config"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 )
 
 var MinioClient *minio.Client
 
-func InitMinio() {
-	endpoint := os.Getenv("MINIO_ENDPOINT")
-	if endpoint == "" {
-		endpoint = "localhost:9000" // Default fallback
-	}
+// Bucket holds every stored file
+var Bucket string
 
-	accessKey := os.Getenv("MINIO_ACCESS_KEY")
-	if accessKey == "" {
-		accessKey = "minioadmin" // Default fallback
-	}
+// endpoint and scheme locate MinIO, used to build object URLs
+var endpoint, scheme string
 
-	secretKey := os.Getenv("MINIO_SECRET_KEY")
-	if secretKey == "" {
-		secretKey = "minioadmin" // Default fallback
+func InitMinio(cfg config.Storage) {
+	host, useSSL, err := cfg.ParseEndpoint()
+	if err != nil {
+		log.Fatalf("Invalid MinIO endpoint: %v", err)
 	}
 
-	useSSL := false // Set to true if using HTTPS
+	transport, err := minio.DefaultTransport(useSSL)
+	if err != nil {
+		log.Fatalf("Failed to set up MinIO transport: %v", err)
+	}
+	if cfg.CAFile != "" {
+		roots, err := loadCABundle(cfg.CAFile)
+		if err != nil {
+			log.Fatalf("Failed to load MinIO CA bundle: %v", err)
+		}
+		transport.TLSClientConfig.RootCAs = roots
+	}
 
-	client, err := minio.New(endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
-		Secure: useSSL,
+	client, err := minio.New(host, &minio.Options{
+		Creds:     credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure:    useSSL,
+		Transport: transport,
 	})
 
 	if err != nil {
@@ -45,7 +54,7 @@ func InitMinio() {
 	defer cancel()
 
 	// Create required buckets if they don't exist
-	bucketName := "secure-files"
+	bucketName := cfg.Bucket
 	exists, err := client.BucketExists(ctx, bucketName)
 	if err != nil {
 		log.Printf("Warning: Failed to check bucket existence: %v", err)
@@ -59,5 +68,31 @@ func InitMinio() {
 	}
 
 	MinioClient = client
+	Bucket = bucketName
+	endpoint, scheme = host, "http"
+	if useSSL {
+		scheme = "https"
+	}
 	fmt.Println("✅ Connected to MinIO")
 }
+
+// loadCABundle returns the system roots plus the certificates in a PEM file
+func loadCABundle(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	if !roots.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return roots, nil
+}
+
+// ObjectURL returns the direct URL of an object in the bucket
+func ObjectURL(objectName string) string {
+	return fmt.Sprintf("%s://%s/%s/%s", scheme, endpoint, Bucket, objectName)
+}
@@ -2,14 +2,31 @@ package tests
 
 import (
 	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/arzan03/SecureShare/internal/config"
+	"github.com/arzan03/SecureShare/internal/db"
+	"github.com/arzan03/SecureShare/internal/events"
+	"github.com/arzan03/SecureShare/internal/services"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 const (
@@ -34,6 +51,14 @@ type presignedResponse struct {
 	ExpiresIn    string `json:"expires_in"`
 }
 
+type listResponse struct {
+	Files []struct {
+		ID string `json:"id"`
+	} `json:"files"`
+	Total      int64  `json:"total"`
+	NextCursor string `json:"next_cursor"`
+}
+
 
 // TestAPIEndpoints runs tests against the API endpoints
 func TestAPIEndpoints(t *testing.T) {
@@ -245,12 +270,59 @@ func TestAPIEndpoints(t *testing.T) {
 		}
 
 		// Just check we can decode the response
-		var files []interface{}
-		if err := json.NewDecoder(resp.Body).Decode(&files); err != nil {
+		var page listResponse
+		if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
 			t.Fatalf("Failed to decode response: %v", err)
 		}
 
-		t.Logf("Found %d files", len(files))
+		t.Logf("Found %d files", page.Total)
+	})
+
+	// Page through files one at a time
+	t.Run("Paginate User Files", func(t *testing.T) {
+		if token == "" {
+			t.Skip("Skipping test due to no auth token")
+		}
+
+		client := &http.Client{}
+		seen := map[string]bool{}
+		cursor := ""
+		for {
+			req, err := http.NewRequest("GET", apiBase+"/file/list?limit=1&sort=name&cursor="+cursor, nil)
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Failed to send request: %v", err)
+			}
+
+			var page listResponse
+			err = json.NewDecoder(resp.Body).Decode(&page)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(page.Files) > 1 {
+				t.Fatalf("Expected at most 1 file per page, got %d", len(page.Files))
+			}
+			for _, f := range page.Files {
+				if seen[f.ID] {
+					t.Fatalf("File %s returned on more than one page", f.ID)
+				}
+				seen[f.ID] = true
+			}
+
+			if page.NextCursor == "" {
+				if int64(len(seen)) != page.Total {
+					t.Errorf("Paged through %d files, expected %d", len(seen), page.Total)
+				}
+				break
+			}
+			cursor = page.NextCursor
+		}
 	})
 
 	// Get file metadata
@@ -282,6 +354,202 @@ func TestAPIEndpoints(t *testing.T) {
 		}
 	})
 
+	// Tag a file and filter the listing by tag and metadata
+	t.Run("Update File Tags", func(t *testing.T) {
+		if token == "" || fileID == "" {
+			t.Skip("Skipping test due to no auth token or file ID")
+		}
+
+		payload := map[string]interface{}{
+			"tags":     []string{"Contract", "apollo-test"},
+			"metadata": map[string]string{"project": "apollo"},
+		}
+		jsonPayload, _ := json.Marshal(payload)
+
+		req, err := http.NewRequest("PATCH", fmt.Sprintf("%s/file/%s", apiBase, fileID), bytes.NewBuffer(jsonPayload))
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		client := &http.Client{}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			bodyBytes, _ := io.ReadAll(resp.Body)
+			t.Fatalf("Failed to update tags. Status: %d, Response: %s", resp.StatusCode, string(bodyBytes))
+		}
+
+		var updated struct {
+			Tags     []string          `json:"tags"`
+			Metadata map[string]string `json:"metadata"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&updated); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if len(updated.Tags) != 2 || updated.Tags[0] != "contract" || updated.Metadata["project"] != "apollo" {
+			t.Fatalf("Unexpected tags or metadata: %+v", updated)
+		}
+
+		listReq, err := http.NewRequest("GET", apiBase+"/file/list?tag=contract&meta.project=apollo", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		listReq.Header.Set("Authorization", "Bearer "+token)
+
+		listResp, err := client.Do(listReq)
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		defer listResp.Body.Close()
+
+		var page listResponse
+		if err := json.NewDecoder(listResp.Body).Decode(&page); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		found := false
+		for _, f := range page.Files {
+			if f.ID == fileID {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Tagged file %s missing from filtered listing", fileID)
+		}
+
+		// Keys are counted together with those already stored
+		extra := map[string]string{}
+		for i := 0; i < 20; i++ {
+			extra[fmt.Sprintf("key%d", i)] = "value"
+		}
+		resp = authRequest(t, "PATCH", fmt.Sprintf("%s/file/%s", apiBase, fileID), token, map[string]interface{}{"metadata": extra})
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected 400 for more than 20 metadata keys, got %d", resp.StatusCode)
+		}
+	})
+
+	// Relevance ranking, prefix matching and per-user scoping of search
+	t.Run("Search Files", func(t *testing.T) {
+		owner := registerAndLogin(t, "searcher@example.com", testPassword)
+		other := registerAndLogin(t, "search-other@example.com", testPassword)
+		admin := adminToken(t)
+
+		byName := uploadTestFile(t, owner, "quokka.txt", "Named after the term")
+		byTag := uploadTestFile(t, owner, "misc.txt", "Only tagged with the term")
+		resp := authRequest(t, "PATCH", apiBase+"/file/"+byTag, owner, map[string]interface{}{"tags": []string{"quokka"}})
+		resp.Body.Close()
+		report := uploadTestFile(t, owner, "report_2024.pdf", "Quarterly report")
+		otherReport := uploadTestFile(t, other, "report_other.pdf", "Someone else's report")
+
+		search := func(url, token string) []string {
+			resp := authRequest(t, "GET", url, token, nil)
+			defer resp.Body.Close()
+			var body struct {
+				Results []struct {
+					ID string `json:"id"`
+				} `json:"results"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || resp.StatusCode != http.StatusOK {
+				t.Fatalf("Search %s failed. Status: %d", url, resp.StatusCode)
+			}
+			ids := []string{}
+			for _, r := range body.Results {
+				ids = append(ids, r.ID)
+			}
+			return ids
+		}
+		indexOf := func(ids []string, id string) int {
+			for i, v := range ids {
+				if v == id {
+					return i
+				}
+			}
+			return -1
+		}
+
+		// A filename match outweighs a tag match
+		ids := search(apiBase+"/file/search?q=quokka", owner)
+		if indexOf(ids, byName) != 0 || indexOf(ids, byTag) != 1 {
+			t.Errorf("Expected the filename match ranked above the tag match, got %v", ids)
+		}
+
+		// A partially typed term still finds the file, but only the caller's
+		ids = search(apiBase+"/file/search?q=rep&limit=100", owner)
+		if indexOf(ids, report) < 0 {
+			t.Errorf("Expected \"rep\" to find report_2024.pdf, got %v", ids)
+		}
+		if indexOf(ids, otherReport) >= 0 {
+			t.Error("Search returned another user's file")
+		}
+
+		// Admins search every user's files
+		ids = search(apiBase+"/admin/files/search?q=rep&limit=100", admin)
+		if indexOf(ids, report) < 0 || indexOf(ids, otherReport) < 0 {
+			t.Errorf("Expected admin search to include both users' reports, got %v", ids)
+		}
+
+		for _, id := range []string{byName, byTag, report} {
+			resp = authRequest(t, "DELETE", apiBase+"/file/"+id, owner, nil)
+			resp.Body.Close()
+		}
+		resp = authRequest(t, "DELETE", apiBase+"/file/"+otherReport, other, nil)
+		resp.Body.Close()
+	})
+
+	// Rename a file, then copy it and make sure both remain downloadable
+	t.Run("Rename And Copy File", func(t *testing.T) {
+		if token == "" || fileID == "" {
+			t.Skip("Skipping test due to no auth token or file ID")
+		}
+
+		client := &http.Client{}
+		post := func(url string, payload interface{}) *http.Response {
+			jsonPayload, _ := json.Marshal(payload)
+			req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonPayload))
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+token)
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Failed to send request: %v", err)
+			}
+			return resp
+		}
+
+		resp := post(fmt.Sprintf("%s/file/%s/rename", apiBase, fileID), map[string]string{"filename": "renamed.txt"})
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Failed to rename file. Status: %d", resp.StatusCode)
+		}
+
+		resp = post(fmt.Sprintf("%s/file/%s/copy", apiBase, fileID), map[string]string{"filename": "copy.txt"})
+		var copyResp fileResponse
+		err := json.NewDecoder(resp.Body).Decode(&copyResp)
+		resp.Body.Close()
+		if err != nil || resp.StatusCode != http.StatusOK || copyResp.File.ID == "" {
+			t.Fatalf("Failed to copy file. Status: %d", resp.StatusCode)
+		}
+
+		for _, id := range []string{fileID, copyResp.File.ID} {
+			resp = post(fmt.Sprintf("%s/file/presigned/%s", apiBase, id), map[string]interface{}{"token_type": "time-limited"})
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("Failed to generate presigned URL for %s. Status: %d", id, resp.StatusCode)
+			}
+		}
+
+		resp = post(apiBase+"/file/delete", map[string]string{"file_id": copyResp.File.ID})
+		resp.Body.Close()
+	})
+
 	// Batch presigned URL generation
 	t.Run("Generate Batch Presigned URLs", func(t *testing.T) {
 		if token == "" || fileID == "" {
@@ -473,7 +741,7 @@ func TestAPIEndpoints(t *testing.T) {
 
 		// Check result for our file
 		result, exists := results[secondFileID].(string)
-		if !exists || result != "Deleted successfully" {
+		if !exists || result != "Moved to trash" {
 			t.Errorf("Failed to delete file %s: %v", secondFileID, result)
 		} else {
 			t.Logf("Successfully batch deleted file: %s", secondFileID)
@@ -503,6 +771,1383 @@ func TestAPIEndpoints(t *testing.T) {
 			t.Log("Verified file is deleted")
 		}
 	})
+
+	// Restore a trashed file, then purge it permanently
+	t.Run("Restore And Purge Trash", func(t *testing.T) {
+		if token == "" || secondFileID == "" {
+			t.Skip("Skipping test due to no auth token or second file ID")
+		}
+
+		client := &http.Client{}
+		do := func(method, url string) *http.Response {
+			req, err := http.NewRequest(method, url, nil)
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Failed to send request: %v", err)
+			}
+			return resp
+		}
+
+		resp := do("GET", apiBase+"/file/trash")
+		var trashResp struct {
+			Files []struct {
+				ID string `json:"id"`
+			} `json:"files"`
+		}
+		err := json.NewDecoder(resp.Body).Decode(&trashResp)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("Failed to decode trash listing: %v", err)
+		}
+		found := false
+		for _, f := range trashResp.Files {
+			if f.ID == secondFileID {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("Trashed file %s not listed in trash", secondFileID)
+		}
+
+		resp = do("POST", fmt.Sprintf("%s/file/trash/%s/restore", apiBase, secondFileID))
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Failed to restore file. Status: %d", resp.StatusCode)
+		}
+
+		resp = do("GET", fmt.Sprintf("%s/file/metadata/%s", apiBase, secondFileID))
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected restored file to be visible, got %d", resp.StatusCode)
+		}
+
+		resp = do("DELETE", fmt.Sprintf("%s/file/%s", apiBase, secondFileID))
+		resp.Body.Close()
+		resp = do("DELETE", fmt.Sprintf("%s/file/trash/%s", apiBase, secondFileID))
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Failed to purge file. Status: %d", resp.StatusCode)
+		}
+
+		resp = do("POST", fmt.Sprintf("%s/file/trash/%s/restore", apiBase, secondFileID))
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected 404 restoring a purged file, got %d", resp.StatusCode)
+		}
+	})
+
+	// Share a file with a second user, then revoke the grant
+	t.Run("Share File With User", func(t *testing.T) {
+		if token == "" {
+			t.Skip("Skipping test due to no auth token")
+		}
+
+		otherToken := registerAndLogin(t, "share-recipient@example.com", testPassword)
+		sharedID := uploadTestFile(t, token, "shared.txt", "Shared file content")
+
+		resp := authRequest(t, "POST", fmt.Sprintf("%s/file/%s/shares", apiBase, sharedID), token,
+			map[string]string{"email": "share-recipient@example.com", "role": "viewer"})
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Failed to share file. Status: %d", resp.StatusCode)
+		}
+
+		resp = authRequest(t, "GET", apiBase+"/file/shared", otherToken, nil)
+		var page listResponse
+		err := json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		found := false
+		for _, f := range page.Files {
+			if f.ID == sharedID {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("Shared file %s missing from shared-with-me listing", sharedID)
+		}
+
+		resp = authRequest(t, "GET", fmt.Sprintf("%s/file/%s/content", apiBase, sharedID), otherToken, nil)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Viewer could not download shared file. Status: %d", resp.StatusCode)
+		}
+
+		resp = authRequest(t, "GET", fmt.Sprintf("%s/file/metadata/%s", apiBase, sharedID), otherToken, nil)
+		var viewerMeta map[string]any
+		err = json.NewDecoder(resp.Body).Decode(&viewerMeta)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("Failed to decode metadata: %v", err)
+		}
+		if _, ok := viewerMeta["link_id"]; ok {
+			t.Errorf("Expected the share link hidden from a viewer, got %v", viewerMeta["link_id"])
+		}
+		if shares, _ := viewerMeta["shares"].([]any); len(shares) != 1 {
+			t.Errorf("Expected a viewer to see only their own grant, got %v", viewerMeta["shares"])
+		}
+
+		resp = authRequest(t, "POST", fmt.Sprintf("%s/file/%s/rename", apiBase, sharedID), otherToken,
+			map[string]string{"filename": "hijacked.txt"})
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("Expected 403 for viewer rename, got %d", resp.StatusCode)
+		}
+
+		resp = authRequest(t, "GET", fmt.Sprintf("%s/file/%s/shares", apiBase, sharedID), token, nil)
+		var sharesResp struct {
+			Shares []struct {
+				UserID string `json:"user_id"`
+			} `json:"shares"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&sharesResp)
+		resp.Body.Close()
+		if err != nil || len(sharesResp.Shares) != 1 {
+			t.Fatalf("Expected one share, got %+v (%v)", sharesResp, err)
+		}
+
+		resp = authRequest(t, "DELETE", fmt.Sprintf("%s/file/%s/shares/%s", apiBase, sharedID, sharesResp.Shares[0].UserID), token, nil)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Failed to revoke share. Status: %d", resp.StatusCode)
+		}
+
+		resp = authRequest(t, "GET", fmt.Sprintf("%s/file/metadata/%s", apiBase, sharedID), otherToken, nil)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected 404 after revocation, got %d", resp.StatusCode)
+		}
+
+		resp = authRequest(t, "DELETE", fmt.Sprintf("%s/file/%s", apiBase, sharedID), token, nil)
+		resp.Body.Close()
+	})
+
+	// Create a team, upload into it and check members see the file
+	t.Run("Team File Space", func(t *testing.T) {
+		if token == "" {
+			t.Skip("Skipping test due to no auth token")
+		}
+
+		memberToken := registerAndLogin(t, "team-member@example.com", testPassword)
+
+		resp := authRequest(t, "POST", apiBase+"/team", token, map[string]string{"name": "Test Team"})
+		var teamResp struct {
+			Team struct {
+				ID string `json:"id"`
+			} `json:"team"`
+		}
+		err := json.NewDecoder(resp.Body).Decode(&teamResp)
+		resp.Body.Close()
+		if err != nil || teamResp.Team.ID == "" {
+			t.Fatalf("Failed to create team. Status: %d", resp.StatusCode)
+		}
+		teamID := teamResp.Team.ID
+
+		resp = authRequest(t, "POST", fmt.Sprintf("%s/team/%s/members", apiBase, teamID), token,
+			map[string]string{"email": "team-member@example.com", "role": "viewer"})
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Failed to add team member. Status: %d", resp.StatusCode)
+		}
+
+		teamFileID := uploadTestFile(t, token, "team.txt", "Team file content")
+		resp = authRequest(t, "POST", fmt.Sprintf("%s/file/%s/transfer", apiBase, teamFileID), token,
+			map[string]string{"team_id": teamID})
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Failed to move file into team. Status: %d", resp.StatusCode)
+		}
+
+		resp = authRequest(t, "GET", fmt.Sprintf("%s/team/%s/files", apiBase, teamID), memberToken, nil)
+		var page listResponse
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil || len(page.Files) != 1 || page.Files[0].ID != teamFileID {
+			t.Fatalf("Team member should see the team file, got %+v", page)
+		}
+
+		resp = authRequest(t, "DELETE", fmt.Sprintf("%s/file/%s", apiBase, teamFileID), memberToken, nil)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("Expected 403 for team viewer delete, got %d", resp.StatusCode)
+		}
+
+		resp = authRequest(t, "DELETE", fmt.Sprintf("%s/file/%s", apiBase, teamFileID), token, nil)
+		resp.Body.Close()
+		resp = authRequest(t, "DELETE", fmt.Sprintf("%s/file/trash/%s", apiBase, teamFileID), token, nil)
+		resp.Body.Close()
+		resp = authRequest(t, "DELETE", fmt.Sprintf("%s/team/%s", apiBase, teamID), token, nil)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Failed to delete empty team. Status: %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("Restricted Share Link", func(t *testing.T) {
+		if token == "" {
+			t.Skip("Skipping test due to no auth token")
+		}
+
+		fileID := uploadTestFile(t, token, "restricted.txt", "Office only")
+
+		// The test client connects from loopback, which the link denies
+		resp := authRequest(t, "POST", fmt.Sprintf("%s/file/presigned/%s", apiBase, fileID), token,
+			map[string]interface{}{
+				"token_type":    "time-limited",
+				"allowed_cidrs": []string{"10.0.0.0/8"},
+				"denied_cidrs":  []string{"127.0.0.0/8", "::1"},
+			})
+		var presignedResp presignedResponse
+		err := json.NewDecoder(resp.Body).Decode(&presignedResp)
+		resp.Body.Close()
+		if err != nil || presignedResp.PresignedURL == "" {
+			t.Fatalf("Failed to generate restricted link. Status: %d", resp.StatusCode)
+		}
+		linkURL, err := url.Parse(presignedResp.PresignedURL)
+		if err != nil {
+			t.Fatalf("Invalid presigned URL: %v", err)
+		}
+
+		resp = authRequest(t, "GET", fmt.Sprintf("%s/file/download/%s?token=%s", apiBase, fileID,
+			url.QueryEscape(linkURL.Query().Get("token"))), token, nil)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("Expected 403 from a denied network, got %d", resp.StatusCode)
+		}
+
+		resp = authRequest(t, "GET", fmt.Sprintf("%s/file/%s/rejections", apiBase, fileID), token, nil)
+		var rejectionsResp struct {
+			Rejections []struct {
+				Reason string `json:"reason"`
+			} `json:"rejections"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&rejectionsResp)
+		resp.Body.Close()
+		if err != nil || len(rejectionsResp.Rejections) != 1 {
+			t.Errorf("Expected one recorded rejection, got %+v", rejectionsResp)
+		}
+
+		// A client can prepend an allowed address to X-Forwarded-For, but the
+		// proxy appends the address it really saw, and only that one counts
+		resp = authRequest(t, "POST", fmt.Sprintf("%s/file/presigned/%s", apiBase, fileID), token,
+			map[string]interface{}{
+				"token_type":    "time-limited",
+				"allowed_cidrs": []string{"10.0.0.0/8"},
+			})
+		err = json.NewDecoder(resp.Body).Decode(&presignedResp)
+		resp.Body.Close()
+		if err != nil || presignedResp.PresignedURL == "" {
+			t.Fatalf("Failed to generate restricted link. Status: %d", resp.StatusCode)
+		}
+		linkURL, err = url.Parse(presignedResp.PresignedURL)
+		if err != nil {
+			t.Fatalf("Invalid presigned URL: %v", err)
+		}
+		req, err := http.NewRequest("GET", fmt.Sprintf("%s/file/download/%s?token=%s", apiBase, fileID,
+			url.QueryEscape(linkURL.Query().Get("token"))), nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("X-Forwarded-For", "10.1.2.3, 203.0.113.7")
+		resp, err = http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("Expected 403 for a forged X-Forwarded-For entry, got %d", resp.StatusCode)
+		}
+
+		resp = authRequest(t, "DELETE", fmt.Sprintf("%s/file/%s", apiBase, fileID), token, nil)
+		resp.Body.Close()
+	})
+
+	t.Run("Embargoed Share Link", func(t *testing.T) {
+		if token == "" {
+			t.Skip("Skipping test due to no auth token")
+		}
+
+		fileID := uploadTestFile(t, token, "release.txt", "Release bundle")
+
+		resp := authRequest(t, "POST", fmt.Sprintf("%s/file/presigned/%s", apiBase, fileID), token,
+			map[string]interface{}{
+				"token_type": "time-limited",
+				"duration":   60,
+				"not_before": time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+			})
+		var presignedResp presignedResponse
+		err := json.NewDecoder(resp.Body).Decode(&presignedResp)
+		resp.Body.Close()
+		if err != nil || presignedResp.PresignedURL == "" {
+			t.Fatalf("Failed to generate embargoed link. Status: %d", resp.StatusCode)
+		}
+		linkURL, err := url.Parse(presignedResp.PresignedURL)
+		if err != nil {
+			t.Fatalf("Invalid presigned URL: %v", err)
+		}
+		downloadURL := fmt.Sprintf("%s/file/download/%s?token=%s", apiBase, fileID,
+			url.QueryEscape(linkURL.Query().Get("token")))
+
+		resp = authRequest(t, "GET", downloadURL, token, nil)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("Expected 403 before the embargo lifts, got %d", resp.StatusCode)
+		}
+
+		// Releasing the embargo makes the link redeemable straight away
+		resp = authRequest(t, "POST", fmt.Sprintf("%s/file/%s/link/reschedule", apiBase, fileID), token,
+			map[string]string{"not_before": ""})
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Failed to reschedule link. Status: %d", resp.StatusCode)
+		}
+
+		resp = authRequest(t, "GET", downloadURL, token, nil)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected the released link to work, got %d", resp.StatusCode)
+		}
+
+		resp = authRequest(t, "DELETE", fmt.Sprintf("%s/file/%s", apiBase, fileID), token, nil)
+		resp.Body.Close()
+	})
+
+	t.Run("Share Link Access Log", func(t *testing.T) {
+		if token == "" {
+			t.Skip("Skipping test due to no auth token")
+		}
+
+		fileID := uploadTestFile(t, token, "tracked.txt", "Tracked download")
+
+		resp := authRequest(t, "POST", fmt.Sprintf("%s/file/presigned/%s", apiBase, fileID), token,
+			map[string]interface{}{"token_type": "time-limited"})
+		var presignedResp presignedResponse
+		err := json.NewDecoder(resp.Body).Decode(&presignedResp)
+		resp.Body.Close()
+		if err != nil || presignedResp.PresignedURL == "" {
+			t.Fatalf("Failed to generate link. Status: %d", resp.StatusCode)
+		}
+		linkURL, err := url.Parse(presignedResp.PresignedURL)
+		if err != nil {
+			t.Fatalf("Invalid presigned URL: %v", err)
+		}
+
+		resp = authRequest(t, "GET", fmt.Sprintf("%s/file/download/%s?token=%s", apiBase, fileID,
+			url.QueryEscape(linkURL.Query().Get("token"))), token, nil)
+		resp.Body.Close()
+		resp = authRequest(t, "GET", fmt.Sprintf("%s/file/download/%s?token=wrong", apiBase, fileID), token, nil)
+		resp.Body.Close()
+
+		type accessSummary struct {
+			Total      int `json:"total"`
+			Successful int `json:"successful"`
+			Failed     int `json:"failed"`
+			Recent     []struct {
+				Success bool `json:"success"`
+			} `json:"recent"`
+		}
+
+		resp = authRequest(t, "GET", fmt.Sprintf("%s/file/%s/access", apiBase, fileID), token, nil)
+		var fileSummary accessSummary
+		err = json.NewDecoder(resp.Body).Decode(&fileSummary)
+		resp.Body.Close()
+		if err != nil || fileSummary.Total != 2 || fileSummary.Successful != 1 || fileSummary.Failed != 1 {
+			t.Errorf("Expected one successful and one failed access, got %+v", fileSummary)
+		}
+
+		resp = authRequest(t, "GET", fmt.Sprintf("%s/file/metadata/%s", apiBase, fileID), token, nil)
+		var meta struct {
+			LinkID string `json:"link_id"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&meta)
+		resp.Body.Close()
+		if err != nil || meta.LinkID == "" {
+			t.Fatalf("File metadata should carry the link ID")
+		}
+
+		// The wrong token identifies no link, so only the good redemption counts here
+		resp = authRequest(t, "GET", fmt.Sprintf("%s/file/%s/links/%s/access", apiBase, fileID, meta.LinkID), token, nil)
+		var linkSummary accessSummary
+		err = json.NewDecoder(resp.Body).Decode(&linkSummary)
+		resp.Body.Close()
+		if err != nil || linkSummary.Total != 1 || len(linkSummary.Recent) != 1 || !linkSummary.Recent[0].Success {
+			t.Errorf("Expected one successful link access, got %+v", linkSummary)
+		}
+
+		resp = authRequest(t, "DELETE", fmt.Sprintf("%s/file/%s", apiBase, fileID), token, nil)
+		resp.Body.Close()
+	})
+
+	t.Run("Download Notification", func(t *testing.T) {
+		if token == "" {
+			t.Skip("Skipping test due to no auth token")
+		}
+
+		resp := authRequest(t, "PUT", apiBase+"/notifications/preferences", token,
+			map[string]bool{"on_download": true, "on_one_time_consumed": true, "in_app": true})
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Failed to save notification preferences. Status: %d", resp.StatusCode)
+		}
+
+		fileID := uploadTestFile(t, token, "watched.txt", "Watched download")
+		resp = authRequest(t, "POST", fmt.Sprintf("%s/file/presigned/%s", apiBase, fileID), token,
+			map[string]interface{}{"token_type": "one-time"})
+		var presignedResp presignedResponse
+		err := json.NewDecoder(resp.Body).Decode(&presignedResp)
+		resp.Body.Close()
+		if err != nil || presignedResp.PresignedURL == "" {
+			t.Fatalf("Failed to generate link. Status: %d", resp.StatusCode)
+		}
+		linkURL, err := url.Parse(presignedResp.PresignedURL)
+		if err != nil {
+			t.Fatalf("Invalid presigned URL: %v", err)
+		}
+		resp = authRequest(t, "GET", fmt.Sprintf("%s/file/download/%s?token=%s", apiBase, fileID,
+			url.QueryEscape(linkURL.Query().Get("token"))), token, nil)
+		resp.Body.Close()
+
+		// Notifications are delivered in the background
+		var inbox struct {
+			Notifications []struct {
+				Type   string `json:"type"`
+				FileID string `json:"file_id"`
+			} `json:"notifications"`
+		}
+		found := false
+		for i := 0; i < 10 && !found; i++ {
+			time.Sleep(200 * time.Millisecond)
+			resp = authRequest(t, "GET", apiBase+"/notifications?unread=true", token, nil)
+			json.NewDecoder(resp.Body).Decode(&inbox)
+			resp.Body.Close()
+			for _, n := range inbox.Notifications {
+				if n.FileID == fileID && n.Type == "link.consumed" {
+					found = true
+				}
+			}
+		}
+		if !found {
+			t.Errorf("Expected a link.consumed notification, got %+v", inbox)
+		}
+
+		// Direct downloads notify too, except the owner's own
+		resp = authRequest(t, "GET", fmt.Sprintf("%s/file/%s/content", apiBase, fileID), token, nil)
+		resp.Body.Close()
+		granteeToken := registerAndLogin(t, "notify-grantee@example.com", testPassword)
+		resp = authRequest(t, "POST", fmt.Sprintf("%s/file/%s/shares", apiBase, fileID), token,
+			map[string]string{"email": "notify-grantee@example.com", "role": "viewer"})
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Failed to share file. Status: %d", resp.StatusCode)
+		}
+		resp = authRequest(t, "GET", fmt.Sprintf("%s/file/%s/content", apiBase, fileID), granteeToken, nil)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Grantee could not download file. Status: %d", resp.StatusCode)
+		}
+
+		downloads := 0
+		for i := 0; i < 10 && downloads == 0; i++ {
+			time.Sleep(200 * time.Millisecond)
+			resp = authRequest(t, "GET", apiBase+"/notifications?unread=true", token, nil)
+			json.NewDecoder(resp.Body).Decode(&inbox)
+			resp.Body.Close()
+			for _, n := range inbox.Notifications {
+				if n.FileID == fileID && n.Type == "file.downloaded" {
+					downloads++
+				}
+			}
+		}
+		if downloads != 1 {
+			t.Errorf("Expected one file.downloaded notification for the grantee, got %d: %+v", downloads, inbox)
+		}
+
+		resp = authRequest(t, "POST", apiBase+"/notifications/read", token, nil)
+		resp.Body.Close()
+		resp = authRequest(t, "PUT", apiBase+"/notifications/preferences", token, map[string]bool{"in_app": true})
+		resp.Body.Close()
+		resp = authRequest(t, "DELETE", fmt.Sprintf("%s/file/%s", apiBase, fileID), token, nil)
+		resp.Body.Close()
+	})
+
+	t.Run("Webhook Delivery", func(t *testing.T) {
+		if token == "" {
+			t.Skip("Skipping test due to no auth token")
+		}
+
+		type received struct {
+			event     string
+			timestamp string
+			signature string
+			body      []byte
+		}
+		deliveries := make(chan received, 10)
+		// Reaching a loopback receiver needs the server to run with ALLOW_PRIVATE_WEBHOOKS
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			deliveries <- received{
+				event:     r.Header.Get("X-SecureShare-Event"),
+				timestamp: r.Header.Get("X-SecureShare-Timestamp"),
+				signature: r.Header.Get("X-SecureShare-Signature"),
+				body:      body,
+			}
+		}))
+		defer receiver.Close()
+
+		resp := authRequest(t, "POST", apiBase+"/webhooks", token,
+			map[string]interface{}{"url": receiver.URL, "events": []string{"file.uploaded"}})
+		var hookResp struct {
+			Webhook struct {
+				ID string `json:"id"`
+			} `json:"webhook"`
+			Secret string `json:"secret"`
+		}
+		err := json.NewDecoder(resp.Body).Decode(&hookResp)
+		resp.Body.Close()
+		if err != nil || hookResp.Secret == "" {
+			t.Fatalf("Failed to create webhook. Status: %d", resp.StatusCode)
+		}
+
+		fileID := uploadTestFile(t, token, "hooked.txt", "Webhook payload")
+
+		select {
+		case d := <-deliveries:
+			if d.event != "file.uploaded" {
+				t.Errorf("Expected file.uploaded, got %q", d.event)
+			}
+			mac := hmac.New(sha256.New, []byte(hookResp.Secret))
+			mac.Write([]byte(d.timestamp + "."))
+			mac.Write(d.body)
+			if expected := "sha256=" + hex.EncodeToString(mac.Sum(nil)); d.signature != expected {
+				t.Errorf("Signature mismatch: got %s, want %s", d.signature, expected)
+			}
+			if !bytes.Contains(d.body, []byte(fileID)) {
+				t.Errorf("Payload does not mention the uploaded file: %s", d.body)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Webhook was not delivered")
+		}
+
+		// Wait for the delivery to be recorded, then redeliver it
+		var logResp struct {
+			Deliveries []struct {
+				ID     string `json:"id"`
+				Status string `json:"status"`
+			} `json:"deliveries"`
+		}
+		for i := 0; i < 10; i++ {
+			resp = authRequest(t, "GET", fmt.Sprintf("%s/webhooks/%s/deliveries", apiBase, hookResp.Webhook.ID), token, nil)
+			json.NewDecoder(resp.Body).Decode(&logResp)
+			resp.Body.Close()
+			if len(logResp.Deliveries) == 1 && logResp.Deliveries[0].Status == "succeeded" {
+				break
+			}
+			time.Sleep(200 * time.Millisecond)
+		}
+		if len(logResp.Deliveries) != 1 || logResp.Deliveries[0].Status != "succeeded" {
+			t.Fatalf("Expected one succeeded delivery, got %+v", logResp)
+		}
+
+		resp = authRequest(t, "POST", fmt.Sprintf("%s/webhooks/%s/deliveries/%s/redeliver", apiBase,
+			hookResp.Webhook.ID, logResp.Deliveries[0].ID), token, nil)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Failed to redeliver. Status: %d", resp.StatusCode)
+		}
+		select {
+		case <-deliveries:
+		case <-time.After(5 * time.Second):
+			t.Error("Redelivery did not arrive")
+		}
+
+		// Copies are new files too
+		resp = authRequest(t, "POST", fmt.Sprintf("%s/file/%s/copy", apiBase, fileID), token, map[string]string{"filename": "hooked-copy.txt"})
+		var copyResp fileResponse
+		json.NewDecoder(resp.Body).Decode(&copyResp)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || copyResp.File.ID == "" {
+			t.Fatalf("Failed to copy file. Status: %d", resp.StatusCode)
+		}
+		select {
+		case d := <-deliveries:
+			if d.event != "file.uploaded" || !bytes.Contains(d.body, []byte(copyResp.File.ID)) {
+				t.Errorf("Expected file.uploaded for the copy, got %q: %s", d.event, d.body)
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("Copy was not delivered")
+		}
+		resp = authRequest(t, "DELETE", fmt.Sprintf("%s/file/%s", apiBase, copyResp.File.ID), token, nil)
+		resp.Body.Close()
+
+		resp = authRequest(t, "DELETE", fmt.Sprintf("%s/webhooks/%s", apiBase, hookResp.Webhook.ID), token, nil)
+		resp.Body.Close()
+		resp = authRequest(t, "DELETE", fmt.Sprintf("%s/file/%s", apiBase, fileID), token, nil)
+		resp.Body.Close()
+	})
+
+	t.Run("Upload Request Link", func(t *testing.T) {
+		if token == "" {
+			t.Skip("Skipping test due to no auth token")
+		}
+
+		resp := authRequest(t, "POST", apiBase+"/file/requests", token,
+			map[string]interface{}{"title": "Send me your report", "max_files": 1})
+		var reqResp struct {
+			UploadRequest struct {
+				ID    string `json:"id"`
+				Token string `json:"token"`
+			} `json:"upload_request"`
+		}
+		err := json.NewDecoder(resp.Body).Decode(&reqResp)
+		resp.Body.Close()
+		if err != nil || reqResp.UploadRequest.Token == "" {
+			t.Fatalf("Failed to create upload request. Status: %d", resp.StatusCode)
+		}
+
+		anonymousUpload := func() int {
+			body := &bytes.Buffer{}
+			writer := multipart.NewWriter(body)
+			part, _ := writer.CreateFormFile("file", "report.txt")
+			part.Write([]byte("External contribution"))
+			writer.WriteField("name", "Outside Contributor")
+			writer.Close()
+
+			resp, err := http.Post(apiBase+"/upload/"+reqResp.UploadRequest.Token, writer.FormDataContentType(), body)
+			if err != nil {
+				t.Fatalf("Failed to send request: %v", err)
+			}
+			resp.Body.Close()
+			return resp.StatusCode
+		}
+
+		if status := anonymousUpload(); status != http.StatusOK {
+			t.Fatalf("Anonymous upload failed. Status: %d", status)
+		}
+		if status := anonymousUpload(); status != http.StatusNotFound {
+			t.Errorf("Expected 404 once the link is full, got %d", status)
+		}
+
+		resp = authRequest(t, "GET", fmt.Sprintf("%s/file/requests/%s/files", apiBase, reqResp.UploadRequest.ID), token, nil)
+		var page listResponse
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil || len(page.Files) != 1 {
+			t.Fatalf("Owner should see one received file, got %+v", page)
+		}
+
+		resp = authRequest(t, "DELETE", fmt.Sprintf("%s/file/%s", apiBase, page.Files[0].ID), token, nil)
+		resp.Body.Close()
+		resp = authRequest(t, "DELETE", fmt.Sprintf("%s/file/requests/%s", apiBase, reqResp.UploadRequest.ID), token, nil)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Failed to revoke upload request. Status: %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("Audit Log", func(t *testing.T) {
+		admin := adminToken(t)
+
+		resp := authRequest(t, "POST", apiBase+"/auth/login", "",
+			map[string]string{"email": "audit-nobody@example.com", "password": "wrong"})
+		resp.Body.Close()
+
+		var page struct {
+			Entries []struct {
+				Seq        int64  `json:"seq"`
+				Action     string `json:"action"`
+				ActorEmail string `json:"actor_email"`
+				Hash       string `json:"hash"`
+			} `json:"entries"`
+		}
+		query := url.Values{"action": {"user.login_failed"}, "limit": {"100"}}
+		for i := 0; i < 25; i++ {
+			resp = authRequest(t, "GET", apiBase+"/admin/audit?"+query.Encode(), admin, nil)
+			json.NewDecoder(resp.Body).Decode(&page)
+			resp.Body.Close()
+			found := false
+			for _, e := range page.Entries {
+				found = found || e.ActorEmail == "audit-nobody@example.com"
+			}
+			if found {
+				break
+			}
+			time.Sleep(200 * time.Millisecond)
+		}
+		if len(page.Entries) == 0 || page.Entries[len(page.Entries)-1].Hash == "" {
+			t.Fatalf("Failed login was not audited, got %+v", page)
+		}
+
+		if token != "" {
+			resp = authRequest(t, "GET", apiBase+"/admin/audit", token, nil)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusForbidden {
+				t.Errorf("Expected 403 for a non-admin, got %d", resp.StatusCode)
+			}
+		}
+
+		resp = authRequest(t, "GET", apiBase+"/admin/audit/verify", admin, nil)
+		var report struct {
+			Checked  int64 `json:"checked"`
+			Valid    bool  `json:"valid"`
+			Problems []struct {
+				Seq    int64  `json:"seq"`
+				Reason string `json:"reason"`
+			} `json:"problems"`
+		}
+		err := json.NewDecoder(resp.Body).Decode(&report)
+		resp.Body.Close()
+		if err != nil || !report.Valid || report.Checked == 0 {
+			t.Errorf("Expected a valid audit chain, got %+v", report)
+		}
+
+		resp = authRequest(t, "GET", apiBase+"/admin/audit/export?format=csv&action=user.login_failed", admin, nil)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || !bytes.HasPrefix(body, []byte("seq,time,action")) {
+			t.Errorf("Unexpected CSV export. Status: %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("Admin User Management", func(t *testing.T) {
+		admin := adminToken(t)
+		credentials := map[string]string{"email": "managed-user@example.com", "password": testPassword}
+		userToken := registerAndLogin(t, credentials["email"], credentials["password"])
+		uploadTestFile(t, userToken, "managed.txt", "Owned by a managed user")
+
+		claims := jwt.MapClaims{}
+		jwt.NewParser().ParseUnverified(userToken, claims)
+		userID, _ := claims["user_id"].(string)
+		userURL := apiBase + "/admin/user/" + userID
+
+		status := func(method, url, token string, payload interface{}) int {
+			resp := authRequest(t, method, url, token, payload)
+			resp.Body.Close()
+			return resp.StatusCode
+		}
+
+		resp := authRequest(t, "POST", apiBase+"/team", userToken, map[string]string{"name": "Managed Team"})
+		var teamResp struct {
+			Team struct {
+				ID string `json:"id"`
+			} `json:"team"`
+		}
+		json.NewDecoder(resp.Body).Decode(&teamResp)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || teamResp.Team.ID == "" {
+			t.Fatalf("Failed to create team. Status: %d", resp.StatusCode)
+		}
+		if got := status("DELETE", userURL, admin, nil); got != http.StatusConflict {
+			t.Errorf("Expected 409 deleting a team's only owner, got %d", got)
+		}
+		if got := status("DELETE", apiBase+"/team/"+teamResp.Team.ID, userToken, nil); got != http.StatusOK {
+			t.Fatalf("Failed to delete team. Status: %d", got)
+		}
+
+		if got := status("POST", userURL+"/suspend", admin, map[string]string{"reason": "testing"}); got != http.StatusOK {
+			t.Fatalf("Failed to suspend user. Status: %d", got)
+		}
+		if got := status("GET", apiBase+"/file/list", userToken, nil); got != http.StatusForbidden {
+			t.Errorf("Expected 403 for a suspended user's token, got %d", got)
+		}
+		if got := status("POST", apiBase+"/auth/login", "", credentials); got != http.StatusForbidden {
+			t.Errorf("Expected 403 when a suspended user logs in, got %d", got)
+		}
+		if got := status("POST", userURL+"/reactivate", admin, nil); got != http.StatusOK {
+			t.Fatalf("Failed to reactivate user. Status: %d", got)
+		}
+		if got := status("GET", apiBase+"/file/list", userToken, nil); got != http.StatusOK {
+			t.Errorf("Expected the token to work again after reactivation, got %d", got)
+		}
+
+		time.Sleep(time.Second) // Token issue times have second precision
+		if got := status("PUT", userURL+"/role", admin, map[string]string{"role": "admin"}); got != http.StatusOK {
+			t.Fatalf("Failed to change role. Status: %d", got)
+		}
+		if got := status("GET", apiBase+"/file/list", userToken, nil); got != http.StatusUnauthorized {
+			t.Errorf("Expected tokens issued before a role change to be revoked, got %d", got)
+		}
+
+		if got := status("POST", userURL+"/password-reset", admin, nil); got != http.StatusOK {
+			t.Fatalf("Failed to force a password reset. Status: %d", got)
+		}
+		if got := status("POST", apiBase+"/auth/login", "", credentials); got != http.StatusForbidden {
+			t.Errorf("Expected 403 while a password reset is pending, got %d", got)
+		}
+
+		resp = authRequest(t, "DELETE", userURL, admin, nil)
+		var deleteResp struct {
+			FilesDeleted int `json:"files_deleted"`
+		}
+		json.NewDecoder(resp.Body).Decode(&deleteResp)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || deleteResp.FilesDeleted != 1 {
+			t.Fatalf("Expected the user and their file to be deleted. Status: %d, files: %d", resp.StatusCode, deleteResp.FilesDeleted)
+		}
+		if got := status("POST", apiBase+"/auth/login", "", credentials); got != http.StatusUnauthorized {
+			t.Errorf("Expected a deleted user to be unable to log in, got %d", got)
+		}
+	})
+
+	t.Run("Admin File Deletion", func(t *testing.T) {
+		if token == "" {
+			t.Skip("Skipping test due to no auth token")
+		}
+		admin := adminToken(t)
+
+		fileID := uploadTestFile(t, token, "admin-delete.txt", "Removed by an admin")
+		fileURL := fmt.Sprintf("%s/admin/file/%s", apiBase, fileID)
+
+		resp := authRequest(t, "DELETE", fileURL+"?dry_run=true", admin, nil)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Dry run failed. Status: %d", resp.StatusCode)
+		}
+		resp = authRequest(t, "GET", fmt.Sprintf("%s/file/%s", apiBase, fileID), token, nil)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Dry run should not delete the file, got %d", resp.StatusCode)
+		}
+
+		resp = authRequest(t, "DELETE", fileURL, admin, nil)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Failed to delete file as admin. Status: %d", resp.StatusCode)
+		}
+		resp = authRequest(t, "GET", fmt.Sprintf("%s/file/%s", apiBase, fileID), token, nil)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected the file to be gone, got %d", resp.StatusCode)
+		}
+
+		resp = authRequest(t, "POST", apiBase+"/admin/files/bulk-delete", admin, map[string]interface{}{})
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected an empty bulk filter to be refused, got %d", resp.StatusCode)
+		}
+
+		resp = authRequest(t, "POST", apiBase+"/admin/files/bulk-delete", admin,
+			map[string]interface{}{"min_size": 1 << 40, "dry_run": true})
+		var result struct {
+			DryRun  bool  `json:"dry_run"`
+			Matched int64 `json:"matched"`
+			Deleted int   `json:"deleted"`
+		}
+		err := json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil || !result.DryRun || result.Matched != 0 || result.Deleted != 0 {
+			t.Errorf("Unexpected bulk dry run result %+v", result)
+		}
+	})
+
+	t.Run("Admin Stats", func(t *testing.T) {
+		admin := adminToken(t)
+
+		resp := authRequest(t, "GET", apiBase+"/admin/stats?top=5&days=7", admin, nil)
+		var stats struct {
+			Users   int64 `json:"users"`
+			Storage struct {
+				Files int64 `json:"files"`
+				Bytes int64 `json:"bytes"`
+			} `json:"storage"`
+			TopUsers      []map[string]interface{} `json:"top_users"`
+			UploadsPerDay []map[string]interface{} `json:"uploads_per_day"`
+			ActiveLinks   map[string]int64         `json:"active_links"`
+		}
+		err := json.NewDecoder(resp.Body).Decode(&stats)
+		resp.Body.Close()
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("Failed to fetch stats. Status: %d", resp.StatusCode)
+		}
+		if stats.Users == 0 || stats.TopUsers == nil || stats.UploadsPerDay == nil || stats.ActiveLinks == nil {
+			t.Errorf("Incomplete stats %+v", stats)
+		}
+		if len(stats.TopUsers) > 5 {
+			t.Errorf("Expected at most 5 top users, got %d", len(stats.TopUsers))
+		}
+	})
+
+	t.Run("Storage Reconciliation", func(t *testing.T) {
+		admin := adminToken(t)
+
+		resp := authRequest(t, "POST", apiBase+"/admin/storage/reconcile", admin, nil)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("Failed to start reconciliation. Status: %d", resp.StatusCode)
+		}
+
+		// The run continues in the background; poll until it reports a result
+		var status struct {
+			Running bool `json:"running"`
+			Last    *struct {
+				Repair         bool  `json:"repair"`
+				ObjectsScanned int64 `json:"objects_scanned"`
+				RecordsScanned int64 `json:"records_scanned"`
+				ObjectsRemoved int64 `json:"objects_removed"`
+				RecordsRemoved int64 `json:"records_removed"`
+			} `json:"last"`
+			LastError string `json:"last_error"`
+		}
+		for i := 0; i < 50; i++ {
+			resp = authRequest(t, "GET", apiBase+"/admin/storage/reconcile", admin, nil)
+			err := json.NewDecoder(resp.Body).Decode(&status)
+			resp.Body.Close()
+			if err != nil || resp.StatusCode != http.StatusOK {
+				t.Fatalf("Failed to fetch reconciliation status. Status: %d", resp.StatusCode)
+			}
+			if !status.Running {
+				break
+			}
+			time.Sleep(200 * time.Millisecond)
+		}
+		if status.Running || status.Last == nil || status.LastError != "" {
+			t.Fatalf("Reconciliation did not complete: %+v", status)
+		}
+		if status.Last.Repair || status.Last.ObjectsRemoved != 0 || status.Last.RecordsRemoved != 0 {
+			t.Errorf("A report-only run must not repair anything, got %+v", *status.Last)
+		}
+	})
+
+	t.Run("Admin User View", func(t *testing.T) {
+		admin := adminToken(t)
+		userToken := registerAndLogin(t, "viewed-user@example.com", testPassword)
+		fileID := uploadTestFile(t, userToken, "viewed.txt", "Counted in the admin view")
+
+		claims := jwt.MapClaims{}
+		jwt.NewParser().ParseUnverified(userToken, claims)
+		userID, _ := claims["user_id"].(string)
+
+		resp := authRequest(t, "GET", apiBase+"/admin/user/"+userID, admin, nil)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Failed to fetch user. Status: %d", resp.StatusCode)
+		}
+		if bytes.Contains(body, []byte("password\"")) || bytes.Contains(body, []byte("$2a$")) {
+			t.Errorf("Admin user view leaks credentials: %s", body)
+		}
+		var view struct {
+			Email       string     `json:"email"`
+			FileCount   int64      `json:"file_count"`
+			StorageUsed int64      `json:"storage_used"`
+			LastLoginAt *time.Time `json:"last_login_at"`
+		}
+		json.Unmarshal(body, &view)
+		if view.Email != "viewed-user@example.com" || view.FileCount < 1 || view.StorageUsed < 1 || view.LastLoginAt == nil {
+			t.Errorf("Unexpected user view %+v", view)
+		}
+
+		resp = authRequest(t, "GET", apiBase+"/admin/users?email=viewed-user&limit=5", admin, nil)
+		body, _ = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if bytes.Contains(body, []byte("$2a$")) || !bytes.Contains(body, []byte("viewed-user@example.com")) {
+			t.Errorf("Unexpected user listing: %s", body)
+		}
+
+		resp = authRequest(t, "DELETE", fmt.Sprintf("%s/file/%s", apiBase, fileID), userToken, nil)
+		resp.Body.Close()
+	})
+
+	t.Run("Admin File Support", func(t *testing.T) {
+		admin := adminToken(t)
+		userToken := registerAndLogin(t, "support-user@example.com", testPassword)
+		fileID := uploadTestFile(t, userToken, "support.txt", "Needed by support")
+
+		claims := jwt.MapClaims{}
+		jwt.NewParser().ParseUnverified(userToken, claims)
+		userID, _ := claims["user_id"].(string)
+
+		resp := authRequest(t, "GET", apiBase+"/admin/user/"+userID+"/files?limit=100", admin, nil)
+		var page listResponse
+		err := json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		found := false
+		for _, f := range page.Files {
+			found = found || f.ID == fileID
+		}
+		if err != nil || !found {
+			t.Fatalf("Expected the user's file in the admin listing. Status: %d", resp.StatusCode)
+		}
+
+		resp = authRequest(t, "GET", fmt.Sprintf("%s/admin/file/%s/download", apiBase, fileID), admin, nil)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Admin download failed. Status: %d", resp.StatusCode)
+		}
+
+		// An admin link must not silently revoke the link the owner handed out
+		resp = authRequest(t, "POST", fmt.Sprintf("%s/file/presigned/%s", apiBase, fileID), userToken,
+			map[string]interface{}{"token_type": "time-limited", "duration": 60})
+		var userLink presignedResponse
+		err = json.NewDecoder(resp.Body).Decode(&userLink)
+		resp.Body.Close()
+		if err != nil || userLink.PresignedURL == "" {
+			t.Fatalf("Failed to generate the user's link. Status: %d", resp.StatusCode)
+		}
+		userLinkURL, err := url.Parse(userLink.PresignedURL)
+		if err != nil {
+			t.Fatalf("Invalid presigned URL: %v", err)
+		}
+		userDownload := fmt.Sprintf("%s/file/download/%s?token=%s", apiBase, fileID,
+			url.QueryEscape(userLinkURL.Query().Get("token")))
+
+		resp = authRequest(t, "POST", fmt.Sprintf("%s/admin/file/%s/link", apiBase, fileID), admin,
+			map[string]interface{}{"token_type": "one-time"})
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusConflict {
+			t.Errorf("Expected 409 while the user's link is active, got %d", resp.StatusCode)
+		}
+		resp = authRequest(t, "GET", userDownload, userToken, nil)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected the user's link to still redeem, got %d", resp.StatusCode)
+		}
+
+		resp = authRequest(t, "POST", fmt.Sprintf("%s/admin/file/%s/link?replace=true", apiBase, fileID), admin,
+			map[string]interface{}{"token_type": "one-time"})
+		var linkResp presignedResponse
+		json.NewDecoder(resp.Body).Decode(&linkResp)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || linkResp.PresignedURL == "" {
+			t.Errorf("Admin link creation failed. Status: %d", resp.StatusCode)
+		}
+		resp = authRequest(t, "GET", userDownload, userToken, nil)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected the replaced link to stop working, got %d", resp.StatusCode)
+		}
+
+		var audit struct {
+			Entries []struct {
+				Details map[string]string `json:"details"`
+			} `json:"entries"`
+		}
+		query := url.Values{"action": {"file.downloaded"}, "target": {fileID}}
+		for i := 0; i < 25 && len(audit.Entries) == 0; i++ {
+			time.Sleep(200 * time.Millisecond)
+			resp = authRequest(t, "GET", apiBase+"/admin/audit?"+query.Encode(), admin, nil)
+			json.NewDecoder(resp.Body).Decode(&audit)
+			resp.Body.Close()
+		}
+		if len(audit.Entries) == 0 || audit.Entries[0].Details["admin_access"] != "true" {
+			t.Errorf("Expected the admin download to be audited as admin access, got %+v", audit)
+		}
+
+		resp = authRequest(t, "DELETE", fmt.Sprintf("%s/file/%s", apiBase, fileID), userToken, nil)
+		resp.Body.Close()
+	})
+
+	t.Run("Admin Impersonation", func(t *testing.T) {
+		admin := adminToken(t)
+		userToken := registerAndLogin(t, "impersonated@example.com", testPassword)
+		fileID := uploadTestFile(t, userToken, "impersonated.txt", "Seen by support")
+
+		claims := jwt.MapClaims{}
+		jwt.NewParser().ParseUnverified(userToken, claims)
+		userID, _ := claims["user_id"].(string)
+
+		resp := authRequest(t, "POST", apiBase+"/admin/user/"+userID+"/impersonate", admin, nil)
+		var imp struct {
+			Token         string `json:"token"`
+			Impersonating string `json:"impersonating"`
+		}
+		json.NewDecoder(resp.Body).Decode(&imp)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || imp.Token == "" || imp.Impersonating != userID {
+			t.Fatalf("Impersonation failed. Status: %d", resp.StatusCode)
+		}
+
+		resp = authRequest(t, "GET", apiBase+"/file/list?limit=100", imp.Token, nil)
+		var page listResponse
+		err := json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		found := false
+		for _, f := range page.Files {
+			found = found || f.ID == fileID
+		}
+		if err != nil || !found {
+			t.Errorf("Expected the impersonation token to act as the user. Status: %d", resp.StatusCode)
+		}
+		if resp.Header.Get("X-Impersonated-By") == "" {
+			t.Error("Expected impersonated responses to be marked")
+		}
+
+		resp = authRequest(t, "GET", apiBase+"/admin/users", imp.Token, nil)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("Expected impersonation tokens to be refused on admin routes, got %d", resp.StatusCode)
+		}
+
+		var audit struct {
+			Entries []struct {
+				ActorID      string `json:"actor_id"`
+				Impersonator string `json:"impersonator"`
+			} `json:"entries"`
+		}
+		query := url.Values{"action": {"impersonation.request"}, "actor": {userID}}
+		resp = authRequest(t, "GET", apiBase+"/admin/audit?"+query.Encode(), admin, nil)
+		json.NewDecoder(resp.Body).Decode(&audit)
+		resp.Body.Close()
+		if len(audit.Entries) == 0 || audit.Entries[0].Impersonator == "" {
+			t.Errorf("Expected the impersonated request to be audited, got %+v", audit)
+		}
+
+		resp = authRequest(t, "DELETE", fmt.Sprintf("%s/file/%s", apiBase, fileID), imp.Token, nil)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Failed to delete the file while impersonating. Status: %d", resp.StatusCode)
+		}
+
+		// Domain events record the admin too, not just the request
+		audit.Entries = nil
+		query = url.Values{"action": {"file.deleted"}, "target": {fileID}}
+		for i := 0; i < 25 && len(audit.Entries) == 0; i++ {
+			time.Sleep(200 * time.Millisecond)
+			resp = authRequest(t, "GET", apiBase+"/admin/audit?"+query.Encode(), admin, nil)
+			json.NewDecoder(resp.Body).Decode(&audit)
+			resp.Body.Close()
+		}
+		if len(audit.Entries) == 0 || audit.Entries[0].ActorID != userID || audit.Entries[0].Impersonator == "" {
+			t.Errorf("Expected the impersonated deletion to be audited with the admin, got %+v", audit)
+		}
+	})
+}
+
+// testJWTSecret is used when JWT_SECRET is unset; the server must run with the same secret
+const testJWTSecret = "test_secret"
+
+// loadTestConfig loads the configuration as the server does, with testJWTSecret
+// as the JWT secret unless JWT_SECRET is set
+func loadTestConfig(t *testing.T) *config.Config {
+	t.Helper()
+
+	if os.Getenv("JWT_SECRET") == "" {
+		t.Setenv("JWT_SECRET", testJWTSecret)
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	return cfg
+}
+
+// adminToken signs in as a test account and returns a token for it with the
+// admin role. The server must share the test's JWT secret.
+func adminToken(t *testing.T) string {
+	t.Helper()
+
+	userToken := registerAndLogin(t, "admin@example.com", testPassword)
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(userToken, claims); err != nil {
+		t.Fatalf("Failed to read token claims: %v", err)
+	}
+	userID, _ := claims["user_id"].(string)
+
+	services.Configure(loadTestConfig(t))
+
+	token, err := services.GenerateJWT(userID, "admin")
+	if err != nil {
+		t.Fatalf("Failed to sign admin token: %v", err)
+	}
+	return token
+}
+
+// authRequest sends a JSON request with a bearer token; payload may be nil
+func authRequest(t *testing.T, method, url, token string, payload interface{}) *http.Response {
+	t.Helper()
+
+	var body io.Reader
+	if payload != nil {
+		jsonPayload, _ := json.Marshal(payload)
+		body = bytes.NewBuffer(jsonPayload)
+	}
+
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	return resp
+}
+
+// registerAndLogin registers a user (ignoring "already exists") and returns a JWT
+func registerAndLogin(t *testing.T, email, password string) string {
+	t.Helper()
+
+	credentials := map[string]string{"email": email, "password": password}
+	resp := authRequest(t, "POST", apiBase+"/auth/register", "", credentials)
+	resp.Body.Close()
+
+	resp = authRequest(t, "POST", apiBase+"/auth/login", "", credentials)
+	defer resp.Body.Close()
+
+	var authResp authResponse
+	if err := json.NewDecoder(resp.Body).Decode(&authResp); err != nil || authResp.Token == "" {
+		t.Fatalf("Failed to log in as %s. Status: %d", email, resp.StatusCode)
+	}
+	return authResp.Token
+}
+
+// uploadTestFile uploads a small text file and returns its ID
+func uploadTestFile(t *testing.T, token, filename, content string) string {
+	t.Helper()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatalf("Failed to create form file: %v", err)
+	}
+	part.Write([]byte(content))
+	writer.Close()
+
+	req, err := http.NewRequest("POST", apiBase+"/file/upload", body)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var fileResp fileResponse
+	if err := json.NewDecoder(resp.Body).Decode(&fileResp); err != nil || fileResp.File.ID == "" {
+		t.Fatalf("Failed to upload %s. Status: %d", filename, resp.StatusCode)
+	}
+	return fileResp.File.ID
+}
+
+// TestConfigFile loads settings from a config file, overridden by the environment
+func TestConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/config.yaml"
+	os.WriteFile(path, []byte("storage:\n  bucket: custom-bucket\nauth:\n  token_ttl: 2h\nserver:\n  port: 9090\n"), 0o600)
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("PORT", "9191")
+	t.Setenv("JWT_SECRET", testJWTSecret)
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("Failed to load config file: %v", err)
+	}
+	if cfg.Storage.Bucket != "custom-bucket" || cfg.Auth.TokenTTL != 2*time.Hour || cfg.Server.Port != 9191 {
+		t.Errorf("Unexpected configuration: %+v", cfg)
+	}
+
+	endpoints := map[string]string{"minio:9000": "minio:9000", "http://minio:9000": "minio:9000", "https://minio:9443/": "minio:9443"}
+	for endpoint, want := range endpoints {
+		host, _, err := config.Storage{Endpoint: endpoint}.ParseEndpoint()
+		if err != nil || host != want {
+			t.Errorf("Expected %s to parse as %s, got %q (%v)", endpoint, want, host, err)
+		}
+	}
+	if _, secure, _ := (config.Storage{Endpoint: "https://minio:9443"}).ParseEndpoint(); !secure {
+		t.Error("Expected an https endpoint to use TLS")
+	}
+	if _, _, err := (config.Storage{Endpoint: "ftp://minio/bucket"}).ParseEndpoint(); err == nil {
+		t.Error("Expected an unsupported endpoint to be rejected")
+	}
+
+	os.WriteFile(path, []byte("storage:\n  bucket: Not_A_Bucket\n"), 0o600)
+	if _, err := config.Load(); err == nil {
+		t.Error("Expected an invalid bucket name to be rejected")
+	}
+	os.WriteFile(path, []byte("storage:\n  buckt: typo\n"), 0o600)
+	if _, err := config.Load(); err == nil {
+		t.Error("Expected an unknown key to be rejected")
+	}
+
+	// Tokens must never be signed with a missing or published secret
+	os.WriteFile(path, []byte("storage:\n  bucket: custom-bucket\n"), 0o600)
+	for _, secret := range []string{"", "supersecret"} {
+		t.Setenv("JWT_SECRET", secret)
+		if _, err := config.Load(); err == nil {
+			t.Errorf("Expected JWT secret %q to be rejected", secret)
+		}
+	}
+}
+
+// TestEventOutboxRetry publishes an event whose async subscriber fails once and
+// checks the outbox relay runs it again, while a panicking sync subscriber only
+// fails the publish
+func TestEventOutboxRetry(t *testing.T) {
+	cfg := loadTestConfig(t)
+	// A database of its own, so the server's relay leaves these events alone
+	db.ConnectMongoDB(cfg.Mongo.URI, cfg.Mongo.Database+"_events_test")
+	defer db.Disconnect(context.Background())
+	db.Collection("event_outbox").Drop(context.Background())
+
+	userID := primitive.NewObjectID().Hex()
+	var calls atomic.Int32
+	retried := make(chan struct{})
+	events.SubscribeAsync(events.TypeUserRegistered, "outbox-test", func(ctx context.Context, e events.Event) error {
+		if p, ok := e.Payload.(events.UserRegistered); !ok || p.UserID != userID {
+			return nil
+		}
+		if calls.Add(1) == 1 {
+			return errors.New("receiver unavailable")
+		}
+		close(retried)
+		return nil
+	})
+	events.Subscribe(events.TypeUserRegistered, func(ctx context.Context, e events.Event) error {
+		panic("sync subscriber failed")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		events.Start(ctx)
+		close(stopped)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	err := events.Publish(ctx, events.UserRegistered{UserID: userID, Email: "outbox@example.com"})
+	if err == nil || !strings.Contains(err.Error(), "panic") {
+		t.Errorf("Expected the sync subscriber's panic as an error, got %v", err)
+	}
+
+	// The first retry is due after the outbox backoff, found by the next relay pass
+	select {
+	case <-retried:
+	case <-time.After(30 * time.Second):
+		t.Fatalf("Failed subscriber was not retried; it ran %d times", calls.Load())
+	}
+
+	var entry struct {
+		Status   string `bson:"status"`
+		Attempts int    `bson:"attempts"`
+	}
+	for i := 0; i < 10 && entry.Status != "done"; i++ {
+		time.Sleep(200 * time.Millisecond)
+		db.Collection("event_outbox").FindOne(context.Background(), bson.M{"payload.user_id": userID}).Decode(&entry)
+	}
+	if entry.Status != "done" || entry.Attempts != 1 {
+		t.Errorf("Expected the outbox entry done after one failed attempt, got %+v", entry)
+	}
 }
 
 func TestMain(m *testing.M) {